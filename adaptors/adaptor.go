@@ -16,7 +16,58 @@
 
 package adaptors
 
+import (
+	"context"
+	"time"
+)
+
 type Adaptor interface {
 	New() (Adaptor, error)
 	Decode(jwt string, jwkUri string) (interface{}, error)
 }
+
+// Warmer is implemented by adaptors that can load the key set for a jwks_uri
+// before the first token is decoded.
+type Warmer interface {
+	Warmup(ctx context.Context, jwkUri string) error
+}
+
+// KeySetStatus describes the key set an adaptor last fetched for a jwks_uri.
+type KeySetStatus struct {
+	KeyIds    []string
+	FetchedAt time.Time
+	// ExpiresAt is when the cached key set will be fetched again, zero when
+	// the cache cannot tell
+	ExpiresAt time.Time
+}
+
+// StatusReporter is implemented by adaptors that can report on the key sets
+// they have fetched.
+type StatusReporter interface {
+	KeySetStatus(jwkUri string) (KeySetStatus, bool)
+}
+
+// ContextAdaptor is implemented by adaptors that stop waiting on the key set
+// once the caller's context is done.
+type ContextAdaptor interface {
+	Adaptor
+	DecodeContext(ctx context.Context, jwt string, jwkUri string) (interface{}, error)
+}
+
+// DecodeContext decodes jwt with DecodeContext when the adaptor implements
+// ContextAdaptor, and with Decode otherwise.
+func DecodeContext(ctx context.Context, a Adaptor, jwt string, jwkUri string) (interface{}, error) {
+	if ca, ok := a.(ContextAdaptor); ok {
+		return ca.DecodeContext(ctx, jwt, jwkUri)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Decode(jwt, jwkUri)
+}
+
+// Invalidator is implemented by adaptors that can drop the key set cached for
+// a jwks_uri, so that the next Decode fetches it again.
+type Invalidator interface {
+	InvalidateKeySet(jwkUri string) error
+}
@@ -21,25 +21,110 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/okta/okta-jwt-verifier-golang/v2/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/events"
+	"github.com/okta/okta-jwt-verifier-golang/v2/logging"
+	"github.com/okta/okta-jwt-verifier-golang/v2/metrics"
+	"github.com/okta/okta-jwt-verifier-golang/v2/tracing"
 	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
 )
 
-func (lgj *LestrratGoJwx) fetchJwkSet(jwkUri string) (interface{}, error) {
-	return jwk.Fetch(context.Background(), jwkUri, jwk.WithHTTPClient(lgj.Client))
+func (lgj *LestrratGoJwx) fetchJwkSet(jwkUri string) (value interface{}, err error) {
+	ctx, span := lgj.Tracer.Start(context.Background(), tracing.SpanFetch,
+		tracing.String(tracing.AttributeIssuer, lgj.Issuer),
+		tracing.String(tracing.AttributeResource, metrics.ResourceKeys),
+		tracing.String(tracing.AttributeUrl, jwkUri))
+	defer func() { span.End(err) }()
+
+	resp, err := lgj.fetcher.Fetch(ctx, jwkUri)
+	if err != nil {
+		return nil, fmt.Errorf("request for keys was not successful: %w", err)
+	}
+	span.SetAttributes(tracing.Int(tracing.AttributeStatusCode, resp.StatusCode))
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !ok {
+		return nil, fmt.Errorf("request for keys %q was not HTTP 2xx OK, it was: %d", jwkUri, resp.StatusCode)
+	}
+
+	set, err := jwk.Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse keys from %q: %w", jwkUri, err)
+	}
+	lgj.recordStatus(jwkUri, set)
+	return utils.ExpiringValue{Value: set, TTL: resp.TTL}, nil
+}
+
+func (lgj *LestrratGoJwx) recordStatus(jwkUri string, set jwk.Set) {
+	status := adaptors.KeySetStatus{FetchedAt: time.Now()}
+	for i := 0; i < set.Len(); i++ {
+		if key, ok := set.Key(i); ok {
+			status.KeyIds = append(status.KeyIds, key.KeyID())
+		}
+	}
+	lgj.mutex.Lock()
+	previous, known := lgj.status[jwkUri]
+	lgj.status[jwkUri] = status
+	lgj.mutex.Unlock()
+
+	if !known {
+		lgj.Logger.Log(context.Background(), logging.LevelInfo, "fetched key set",
+			logging.F(logging.FieldIssuer, lgj.Issuer), logging.F(logging.FieldUrl, jwkUri), logging.F(logging.FieldKeyIds, status.KeyIds))
+		return
+	}
+	added, removed := metrics.KeyIdChanges(previous.KeyIds, status.KeyIds)
+	if len(added) == 0 && len(removed) == 0 {
+		lgj.Logger.Log(context.Background(), logging.LevelDebug, "refreshed key set",
+			logging.F(logging.FieldIssuer, lgj.Issuer), logging.F(logging.FieldUrl, jwkUri))
+		return
+	}
+	lgj.Observer.KeyRotationDetected(metrics.KeyRotationEvent{Issuer: lgj.Issuer, JwksUri: jwkUri, Added: added, Removed: removed})
+	if lgj.Events.KeySetChanged != nil {
+		lgj.Events.KeySetChanged(events.KeySetChange{Issuer: lgj.Issuer, JwksUri: jwkUri, Added: added, Removed: removed})
+	}
+	lgj.Logger.Log(context.Background(), logging.LevelInfo, "key set rotated",
+		logging.F(logging.FieldIssuer, lgj.Issuer), logging.F(logging.FieldUrl, jwkUri), logging.F(logging.FieldAdded, added), logging.F(logging.FieldRemoved, removed))
 }
 
 type LestrratGoJwx struct {
+	// Issuer labels the metrics, spans, logs and events of the adaptor
+	Issuer      string
 	JWKSet      jwk.Set
-	Cache       func(func(string) (interface{}, error), time.Duration, time.Duration) (utils.Cacher, error)
+	Cache       utils.CacheFactory
 	jwkSetCache utils.Cacher
 	Timeout     time.Duration
 	Cleanup     time.Duration
 	Client      *http.Client
+	// Retry is applied to key set requests, nil disables retries
+	Retry *utils.RetryPolicy
+	// FetchTimeout bounds each key set request, retries included, zero
+	// leaves it unbounded
+	FetchTimeout time.Duration
+	// MinTimeout and MaxTimeout bound how long the key set is cached when
+	// the issuer sends caching headers, zero leaves that side unbounded
+	MinTimeout time.Duration
+	MaxTimeout time.Duration
+	// Observer receives cache, fetch and key rotation events for key sets
+	Observer metrics.Observer
+	// Tracer starts spans around key set lookups, fetches and signature
+	// verification
+	Tracer tracing.Tracer
+	// Logger receives records of key set fetches and rotations
+	Logger logging.Logger
+	// Events are called on key rotations, repeated key set fetch failures
+	// and unknown key ids
+	Events        events.Handlers
+	fetcher       *utils.Fetcher
+	fetchFailures events.FailureCounter
+
+	mutex  sync.Mutex
+	status map[string]adaptors.KeySetStatus
 }
 
 func (lgj *LestrratGoJwx) New() (adaptors.Adaptor, error) {
@@ -47,26 +132,63 @@ func (lgj *LestrratGoJwx) New() (adaptors.Adaptor, error) {
 	if lgj.Cache == nil {
 		lgj.Cache = utils.NewDefaultCache
 	}
+	if lgj.Client == nil {
+		lgj.Client = http.DefaultClient
+	}
+	if lgj.Observer == nil {
+		lgj.Observer = metrics.Nop{}
+	}
+	if lgj.Tracer == nil {
+		lgj.Tracer = tracing.Nop{}
+	}
+	if lgj.Logger == nil {
+		lgj.Logger = logging.Nop{}
+	}
+	lgj.status = map[string]adaptors.KeySetStatus{}
+	lgj.fetcher = &utils.Fetcher{
+		Client:  lgj.Client,
+		Retry:   lgj.Retry,
+		MinTTL:  lgj.MinTimeout,
+		MaxTTL:  lgj.MaxTimeout,
+		Timeout: lgj.FetchTimeout,
+		OnFetch: func(url string, statusCode int, d time.Duration, err error) {
+			lgj.Observer.FetchCompleted(metrics.FetchEvent{
+				Issuer:     lgj.Issuer,
+				Resource:   metrics.ResourceKeys,
+				Url:        url,
+				StatusCode: statusCode,
+				Duration:   d,
+				Err:        err,
+			})
+			logging.LogFetch(lgj.Logger, lgj.Issuer, "keys", url, statusCode, d, err)
+			lgj.fetchFailures.Record(lgj.Events, lgj.Issuer, url, statusCode, err)
+		},
+	}
 	lgj.jwkSetCache, err = lgj.Cache(lgj.fetchJwkSet, lgj.Timeout, lgj.Cleanup)
 	if err != nil {
 		return nil, err
 	}
+	utils.SetCodec(lgj.jwkSetCache, jwkSetCodec{})
 	return lgj, nil
 }
 
 func (lgj *LestrratGoJwx) Decode(jwt string, jwkUri string) (interface{}, error) {
-	value, err := lgj.jwkSetCache.Get(jwkUri)
-	if err != nil {
-		return nil, err
-	}
+	return lgj.DecodeContext(context.Background(), jwt, jwkUri)
+}
 
-	jwkSet, ok := value.(jwk.Set)
-	if !ok {
-		return nil, fmt.Errorf("could not cast %v to jwk.Set", value)
+// DecodeContext verifies the signature of jwt against the key set of jwkUri,
+// it stops waiting on the key set once ctx is done.
+func (lgj *LestrratGoJwx) DecodeContext(ctx context.Context, jwt string, jwkUri string) (interface{}, error) {
+	jwkSet, err := lgj.keySet(ctx, jwkUri)
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonKeysUnavailable, err)
 	}
 
+	_, span := lgj.Tracer.Start(ctx, tracing.SpanVerifySignature)
 	token, err := jws.Verify([]byte(jwt), jws.WithKeySet(jwkSet))
+	span.End(err)
 	if err != nil {
+		lgj.reportUnknownKeyId(jwt, jwkUri, jwkSet)
 		return nil, err
 	}
 
@@ -77,3 +199,118 @@ func (lgj *LestrratGoJwx) Decode(jwt string, jwkUri string) (interface{}, error)
 
 	return claims, nil
 }
+
+func (lgj *LestrratGoJwx) keySet(ctx context.Context, jwkUri string) (set jwk.Set, err error) {
+	ctx, span := lgj.Tracer.Start(ctx, tracing.SpanGetKeySet,
+		tracing.String(tracing.AttributeIssuer, lgj.Issuer),
+		tracing.String(tracing.AttributeUrl, jwkUri))
+	defer func() { span.End(err) }()
+
+	if result, ok := metrics.CacheResultOf(lgj.jwkSetCache, jwkUri, lgj.Timeout); ok {
+		span.SetAttributes(tracing.String(tracing.AttributeCacheResult, string(result)))
+		lgj.Observer.CacheAccessed(metrics.CacheEvent{Issuer: lgj.Issuer, Resource: metrics.ResourceKeys, Key: jwkUri, Result: result})
+	}
+	value, err := utils.GetContext(ctx, lgj.jwkSetCache, jwkUri)
+	if err != nil {
+		return nil, err
+	}
+	jwkSet, err := toJwkSet(value)
+	if err != nil {
+		return nil, err
+	}
+	// key sets shared by another process were not fetched by this one
+	if _, fetched := lgj.KeySetStatus(jwkUri); !fetched {
+		lgj.recordStatus(jwkUri, jwkSet)
+	}
+	return jwkSet, nil
+}
+
+// reportUnknownKeyId calls the UnknownKeyId event when jwt failed to verify
+// because its key id is not in the key set
+func (lgj *LestrratGoJwx) reportUnknownKeyId(jwt, jwkUri string, jwkSet jwk.Set) {
+	if lgj.Events.UnknownKeyId == nil {
+		return
+	}
+	msg, err := jws.Parse([]byte(jwt))
+	if err != nil || len(msg.Signatures()) == 0 {
+		return
+	}
+	kid := msg.Signatures()[0].ProtectedHeaders().KeyID()
+	if _, found := jwkSet.LookupKeyID(kid); kid == "" || found {
+		return
+	}
+	lgj.Events.UnknownKeyId(events.UnknownKeyId{Issuer: lgj.Issuer, JwksUri: jwkUri, KeyId: kid})
+}
+
+// jwkSetCodec serializes key sets to their JWKS document for caches that
+// store them outside of the process
+type jwkSetCodec struct{}
+
+func (jwkSetCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jwkSetCodec) Decode(data []byte) (interface{}, error) {
+	return jwk.Parse(data)
+}
+
+func toJwkSet(value interface{}) (jwk.Set, error) {
+	switch v := utils.UnwrapValue(value).(type) {
+	case jwk.Set:
+		return v, nil
+	case json.RawMessage:
+		// persisted by a cache outside of the process
+		set, err := jwk.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse cached keys: %w", err)
+		}
+		return set, nil
+	default:
+		return nil, fmt.Errorf("could not cast %v to jwk.Set", value)
+	}
+}
+
+// Warmup fetches the key set for jwkUri into the cache.
+func (lgj *LestrratGoJwx) Warmup(ctx context.Context, jwkUri string) error {
+	_, err := lgj.keySet(ctx, jwkUri)
+	return err
+}
+
+// KeySetStatus reports the key ids, fetch time and expiry of the last key
+// set fetched from jwkUri.
+func (lgj *LestrratGoJwx) KeySetStatus(jwkUri string) (adaptors.KeySetStatus, bool) {
+	lgj.mutex.Lock()
+	status, ok := lgj.status[jwkUri]
+	lgj.mutex.Unlock()
+	if !ok {
+		return status, false
+	}
+	if cache, managed := lgj.jwkSetCache.(utils.ManagedCacher); managed {
+		if entry, found := cache.Peek(jwkUri); found && entry.Err == nil {
+			status.ExpiresAt = entry.ExpiresAt
+		} else {
+			// the key set is no longer cached
+			status.ExpiresAt = status.FetchedAt
+		}
+	}
+	return status, true
+}
+
+// InvalidateKeySet drops the key set cached for jwkUri. It requires the
+// cache to implement utils.ManagedCacher.
+func (lgj *LestrratGoJwx) InvalidateKeySet(jwkUri string) error {
+	cache, ok := lgj.jwkSetCache.(utils.ManagedCacher)
+	if !ok {
+		return fmt.Errorf("the key set cache %T does not support invalidation", lgj.jwkSetCache)
+	}
+	cache.Invalidate(jwkUri)
+	return nil
+}
+
+// LestrratGoJwx can be warmed up and reports on its key sets
+var (
+	_ adaptors.Invalidator    = (*LestrratGoJwx)(nil)
+	_ adaptors.ContextAdaptor = (*LestrratGoJwx)(nil)
+	_ adaptors.Warmer         = (*LestrratGoJwx)(nil)
+	_ adaptors.StatusReporter = (*LestrratGoJwx)(nil)
+)
@@ -0,0 +1,165 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidateForcesRefetch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{Issuer: testIssuer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	token := key.Sign(t, validClaims())
+	_, err = jv.VerifyAccessToken(token)
+	require.NoError(t, err)
+
+	require.NoError(t, jv.InvalidateKeys())
+	_, err = jv.VerifyAccessToken(token)
+	require.NoError(t, err)
+	info := httpmock.GetCallCountInfo()
+	require.Equal(t, 1, info["GET "+testIssuer+"/.well-known/openid-configuration"])
+	require.Equal(t, 2, info["GET "+testIssuer+"/v1/keys"])
+
+	require.NoError(t, jv.InvalidateMetadata())
+	_, err = jv.VerifyAccessToken(token)
+	require.NoError(t, err)
+	info = httpmock.GetCallCountInfo()
+	require.Equal(t, 2, info["GET "+testIssuer+"/.well-known/openid-configuration"])
+	require.Equal(t, 2, info["GET "+testIssuer+"/v1/keys"])
+}
+
+// getOnlyCache implements nothing beyond the read-only Cacher interface
+type getOnlyCache struct {
+	lookup func(string) (interface{}, error)
+}
+
+func (c *getOnlyCache) Get(key string) (interface{}, error) {
+	return c.lookup(key)
+}
+
+func TestInvalidateRequiresManagedCache(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{
+		Issuer: testIssuer,
+		Cache: func(lookup func(string) (interface{}, error), _, _ time.Duration) (utils.Cacher, error) {
+			return &getOnlyCache{lookup: lookup}, nil
+		},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.NoError(t, err)
+	require.ErrorContains(t, jv.InvalidateMetadata(), "does not support invalidation")
+	require.ErrorContains(t, jv.InvalidateKeys(), "does not support invalidation")
+}
+
+func TestMetaDataHonorsCacheControl(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(200, `{"issuer":"`+testIssuer+`","jwks_uri":"`+testIssuer+`/v1/keys"}`)
+			resp.Header.Set("Cache-Control", "max-age=120")
+			return resp, nil
+		})
+
+	jvs := JwtVerifier{
+		Issuer:     testIssuer,
+		MaxTimeout: time.Hour,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.getMetaData()
+	require.NoError(t, err)
+
+	entry, found := jv.metadataCache.(utils.ManagedCacher).Peek(testIssuer + "/.well-known/openid-configuration")
+	require.True(t, found)
+	require.InDelta(t, 2*time.Minute, time.Until(entry.ExpiresAt), float64(5*time.Second))
+}
+
+func TestFileCacheServesColdStart(t *testing.T) {
+	mock := httpmock.NewMockTransport()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.RegisterOn(t, mock, key)
+	dir := t.TempDir()
+	token := key.Sign(t, validClaims())
+
+	jvs := JwtVerifier{
+		Issuer: testIssuer,
+		Cache:  utils.NewFileCache(dir),
+		Client: &http.Client{Transport: mock},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(token)
+	require.NoError(t, err)
+
+	// the issuer is unreachable when the next process starts
+	unreachable := httpmock.NewMockTransport()
+	unreachable.RegisterNoResponder(httpmock.NewStringResponder(503, `{}`))
+
+	jvs = JwtVerifier{
+		Issuer: testIssuer,
+		Cache:  utils.NewFileCache(dir),
+		Client: &http.Client{Transport: unreachable},
+		Retry:  &utils.RetryPolicy{},
+	}
+	jv, err = jvs.New()
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(token)
+	require.NoError(t, err)
+}
+
+func TestTieredCacheSharesIssuerDocuments(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+	backend := utils.NewMemoryBackend()
+	token := key.Sign(t, validClaims())
+
+	for i := 0; i < 3; i++ {
+		jvs := JwtVerifier{Issuer: testIssuer, Cache: utils.NewTieredCache(backend)}
+		jv, err := jvs.New()
+		require.NoError(t, err)
+		_, err = jv.VerifyAccessToken(token)
+		require.NoError(t, err)
+		require.True(t, jv.Health().Ready)
+	}
+	require.Equal(t, 2, httpmock.GetTotalCallCount())
+}
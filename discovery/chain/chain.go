@@ -0,0 +1,59 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package chain
+
+import (
+	"github.com/okta/okta-jwt-verifier-golang/v2/discovery"
+	"github.com/okta/okta-jwt-verifier-golang/v2/discovery/oauth"
+	"github.com/okta/okta-jwt-verifier-golang/v2/discovery/oidc"
+)
+
+// Chain tries each of its Strategies in order until one of them returns a
+// metadata document. It defaults to OpenID Connect discovery followed by
+// RFC 8414 authorization server metadata.
+type Chain struct {
+	Strategies []discovery.Discovery
+}
+
+func (d Chain) New() discovery.Discovery {
+	if len(d.Strategies) == 0 {
+		d.Strategies = []discovery.Discovery{oidc.Oidc{}.New(), oauth.Oauth{}.New()}
+	}
+	return d
+}
+
+// GetWellKnownUrl returns the well-known suffix of the first strategy.
+func (d Chain) GetWellKnownUrl() string {
+	if len(d.Strategies) == 0 {
+		return ""
+	}
+	return d.Strategies[0].GetWellKnownUrl()
+}
+
+func (d Chain) GetMetadataUrls(issuer string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, s := range d.Strategies {
+		for _, u := range discovery.MetadataUrls(s, issuer) {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
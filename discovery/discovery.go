@@ -20,3 +20,31 @@ type Discovery interface {
 	New() Discovery
 	GetWellKnownUrl() string
 }
+
+// IssuerDiscovery is implemented by discovery strategies whose metadata URL
+// cannot be built by appending the well-known suffix to the issuer, such as
+// RFC 8414 which inserts it between the host and the issuer's path.
+type IssuerDiscovery interface {
+	Discovery
+	GetMetadataUrl(issuer string) string
+}
+
+// FallbackDiscovery is implemented by discovery strategies that try several
+// metadata locations in order.
+type FallbackDiscovery interface {
+	Discovery
+	GetMetadataUrls(issuer string) []string
+}
+
+// MetadataUrls returns the metadata URLs for the issuer in the order they
+// should be tried.
+func MetadataUrls(d Discovery, issuer string) []string {
+	switch v := d.(type) {
+	case FallbackDiscovery:
+		return v.GetMetadataUrls(issuer)
+	case IssuerDiscovery:
+		return []string{v.GetMetadataUrl(issuer)}
+	default:
+		return []string{issuer + d.GetWellKnownUrl()}
+	}
+}
@@ -0,0 +1,52 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package oauth
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/discovery"
+)
+
+// Oauth discovers OAuth 2.0 Authorization Server Metadata as defined in
+// RFC 8414.
+type Oauth struct {
+	wellKnownUrl string
+}
+
+func (d Oauth) New() discovery.Discovery {
+	d.wellKnownUrl = "/.well-known/oauth-authorization-server"
+	return d
+}
+
+func (d Oauth) GetWellKnownUrl() string {
+	return d.wellKnownUrl
+}
+
+// GetMetadataUrl inserts the well-known segment between the host and the
+// path of the issuer, so "https://example.com/tenant" is looked up at
+// "https://example.com/.well-known/oauth-authorization-server/tenant".
+func (d Oauth) GetMetadataUrl(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return issuer + d.wellKnownUrl
+	}
+	u.Path = d.wellKnownUrl + strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
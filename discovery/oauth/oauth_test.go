@@ -0,0 +1,42 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package oauth_test
+
+import (
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/discovery"
+	"github.com/okta/okta-jwt-verifier-golang/v2/discovery/oauth"
+)
+
+func TestMetadataUrlInsertsWellKnownBeforePath(t *testing.T) {
+	d := oauth.Oauth{}.New()
+
+	tests := map[string]string{
+		"https://example.com":                    "https://example.com/.well-known/oauth-authorization-server",
+		"https://example.com/":                   "https://example.com/.well-known/oauth-authorization-server",
+		"https://example.com/oauth2/default":     "https://example.com/.well-known/oauth-authorization-server/oauth2/default",
+		"https://example.com/oauth2/default/":    "https://example.com/.well-known/oauth-authorization-server/oauth2/default",
+		"https://example.com:8443/tenant/issuer": "https://example.com:8443/.well-known/oauth-authorization-server/tenant/issuer",
+	}
+	for issuer, expected := range tests {
+		urls := discovery.MetadataUrls(d, issuer)
+		if len(urls) != 1 || urls[0] != expected {
+			t.Errorf("issuer %q: expected %q, got %v", issuer, expected, urls)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package dpop
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/replay"
+)
+
+// ProofType is the `typ` header of DPoP proofs
+const ProofType = "dpop+jwt"
+
+// DefaultAlgorithms are the asymmetric algorithms accepted for proofs
+var DefaultAlgorithms = []jwa.SignatureAlgorithm{
+	jwa.RS256, jwa.RS384, jwa.RS512,
+	jwa.PS256, jwa.PS384, jwa.PS512,
+	jwa.ES256, jwa.ES384, jwa.ES512,
+	jwa.EdDSA,
+}
+
+// Verifier verifies the DPoP proofs (RFC 9449) that bind access tokens to a
+// key held by the client.
+type Verifier struct {
+	// Algorithms accepted for proofs, they default to DefaultAlgorithms
+	Algorithms []jwa.SignatureAlgorithm
+	// MaxAge is how long after its `iat` a proof is accepted, it defaults
+	// to 5 minutes
+	MaxAge time.Duration
+	// Leeway tolerates clocks that are ahead, it defaults to 5 seconds
+	Leeway time.Duration
+	// Replay remembers the `jti` of the proofs until they are too old to be
+	// accepted. It defaults to a replay.Memory, use a shared store when
+	// several instances serve the same clients.
+	Replay replay.Store
+	// Nonces, when set, requires proofs to carry a `nonce` issued by the
+	// server in a `DPoP-Nonce` header
+	Nonces Nonces
+	// RequestUrl returns the URL a request was sent to, compared with the
+	// `htu` of proofs. It defaults to the scheme, host and path of the
+	// request, set it when a proxy rewrites them.
+	RequestUrl func(r *http.Request) string
+}
+
+// Proof is a verified DPoP proof.
+type Proof struct {
+	Claims map[string]interface{}
+	Key    jwk.Key
+	// Thumbprint is the base64url encoded SHA-256 thumbprint (RFC 7638) of
+	// Key, found in the `cnf.jkt` claim of the access tokens bound to it
+	Thumbprint string
+}
+
+func (v *Verifier) New() (*Verifier, error) {
+	if len(v.Algorithms) == 0 {
+		v.Algorithms = DefaultAlgorithms
+	}
+	for _, alg := range v.Algorithms {
+		if alg == jwa.NoSignature || strings.HasPrefix(string(alg), "HS") {
+			return nil, fmt.Errorf("the algorithm %s is not asymmetric", alg)
+		}
+	}
+	if v.MaxAge == 0 {
+		v.MaxAge = 5 * time.Minute
+	}
+	if v.Leeway == 0 {
+		v.Leeway = 5 * time.Second
+	}
+	if v.Replay == nil {
+		v.Replay = &replay.Memory{}
+	}
+	if v.RequestUrl == nil {
+		v.RequestUrl = requestUrl
+	}
+	return v, nil
+}
+
+// VerifyRequest verifies the proof of the `DPoP` header of r, sent along
+// accessToken. accessToken may be empty for requests without one, such as
+// token requests.
+func (v *Verifier) VerifyRequest(r *http.Request, accessToken string) (*Proof, error) {
+	return v.verifyRequest(r, accessToken, nil)
+}
+
+// VerifyBoundRequest verifies the proof of r like VerifyRequest, and that
+// accessToken, with claims, is bound to the key of the proof. The binding is
+// checked before the `jti` of the proof is recorded, so that proofs sent with
+// tokens bound to another key, or to none, do not fill the Replay store.
+func (v *Verifier) VerifyBoundRequest(r *http.Request, accessToken string, claims map[string]interface{}) (*Proof, error) {
+	if claims == nil {
+		claims = map[string]interface{}{}
+	}
+	return v.verifyRequest(r, accessToken, claims)
+}
+
+func (v *Verifier) verifyRequest(r *http.Request, accessToken string, tokenClaims map[string]interface{}) (*Proof, error) {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return nil, errors.VerificationError(errors.ReasonInvalidProof,
+			fmt.Errorf("the request must have a single DPoP header, it has %d", len(proofs)))
+	}
+	return v.verify(r.Context(), proofs[0], r.Method, v.RequestUrl(r), accessToken, tokenClaims)
+}
+
+// Verify verifies a proof of a request to method and requestUrl, following
+// RFC 9449 section 4.3.
+func (v *Verifier) Verify(ctx context.Context, proof, method, requestUrl, accessToken string) (*Proof, error) {
+	return v.verify(ctx, proof, method, requestUrl, accessToken, nil)
+}
+
+// verify verifies a proof, and its binding to the access token with
+// tokenClaims when they are not nil
+func (v *Verifier) verify(ctx context.Context, proof, method, requestUrl, accessToken string, tokenClaims map[string]interface{}) (*Proof, error) {
+	if strings.Count(proof, ".") != 2 {
+		return nil, invalidProof("the proof is not a compact JWT")
+	}
+	message, err := jws.Parse([]byte(proof))
+	if err != nil || len(message.Signatures()) != 1 {
+		return nil, invalidProof("the proof is not a well formed JWT")
+	}
+	headers := message.Signatures()[0].ProtectedHeaders()
+	if headers.Type() != ProofType {
+		return nil, invalidProof("the proof type must be %s", ProofType)
+	}
+	alg := headers.Algorithm()
+	if !v.accepts(alg) {
+		return nil, invalidProof("the proof algorithm %s is not accepted", alg)
+	}
+	key := headers.JWK()
+	if key == nil {
+		return nil, invalidProof("the proof has no jwk header")
+	}
+	switch key.(type) {
+	case jwk.RSAPublicKey, jwk.ECDSAPublicKey, jwk.OKPPublicKey:
+	default:
+		return nil, invalidProof("the proof jwk must be a public key")
+	}
+	payload, err := jws.Verify([]byte(proof), jws.WithKey(alg, key))
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonInvalidProof,
+			fmt.Errorf("the proof signature is invalid: %w", err))
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, invalidProof("the proof claims are not a JSON object")
+	}
+
+	if htm, _ := claims["htm"].(string); htm != method {
+		return nil, invalidProof("the proof htm does not match the request method")
+	}
+	if htu, _ := claims["htu"].(string); !sameUrl(htu, requestUrl) {
+		return nil, invalidProof("the proof htu does not match the request URL")
+	}
+	iatf, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, invalidProof("the proof has no iat")
+	}
+	iat := time.Unix(int64(iatf), 0)
+	if time.Since(iat) > v.MaxAge {
+		return nil, invalidProof("the proof is too old")
+	}
+	if time.Until(iat) > v.Leeway {
+		return nil, invalidProof("the proof is issued in the future")
+	}
+	if accessToken != "" {
+		if ath, _ := claims["ath"].(string); ath != tokenHash(accessToken) {
+			return nil, invalidProof("the proof ath does not match the access token")
+		}
+	}
+	if v.Nonces != nil {
+		if nonce, _ := claims["nonce"].(string); nonce == "" || !v.Nonces.Valid(nonce) {
+			return nil, errors.VerificationError(errors.ReasonUseNonce,
+				fmt.Errorf("the proof must carry a nonce issued by the server"))
+		}
+	}
+
+	thumbprint, err := Thumbprint(key)
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonInvalidProof, err)
+	}
+	if tokenClaims != nil {
+		if err := CheckBinding(tokenClaims, &Proof{Thumbprint: thumbprint}); err != nil {
+			return nil, err
+		}
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, invalidProof("the proof has no jti")
+	}
+	first, err := v.Replay.Use(ctx, "dpop#"+thumbprint+"#"+jti, iat.Add(v.MaxAge+v.Leeway))
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonReplayUnavailable,
+			fmt.Errorf("the replay of the proof could not be checked: %w", err))
+	}
+	if !first {
+		return nil, errors.VerificationError(errors.ReasonInvalidProof, replay.ErrReplayed)
+	}
+
+	return &Proof{Claims: claims, Key: key, Thumbprint: thumbprint}, nil
+}
+
+func (v *Verifier) accepts(alg jwa.SignatureAlgorithm) bool {
+	for _, a := range v.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// Bound reports whether an access token is bound to a DPoP key by its
+// `cnf.jkt` claim.
+func Bound(claims map[string]interface{}) bool {
+	return confirmation(claims) != ""
+}
+
+// CheckBinding verifies that the access token with claims is bound to the
+// key of proof.
+func CheckBinding(claims map[string]interface{}, proof *Proof) error {
+	jkt := confirmation(claims)
+	if jkt == "" {
+		return errors.VerificationError(errors.ReasonBinding,
+			fmt.Errorf("the access token is not bound to a DPoP key"))
+	}
+	if jkt != proof.Thumbprint {
+		return errors.VerificationError(errors.ReasonBinding,
+			fmt.Errorf("the access token is bound to another DPoP key"))
+	}
+	return nil
+}
+
+func confirmation(claims map[string]interface{}) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+// Thumbprint returns the base64url encoded SHA-256 thumbprint of key.
+func Thumbprint(key jwk.Key) (string, error) {
+	sum, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("could not compute the key thumbprint: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+// tokenHash returns the `ath` of an access token
+func tokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func requestUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// sameUrl compares two URLs without their query and fragment, after the
+// syntax and scheme based normalizations of RFC 3986 section 6.2
+func sameUrl(a, b string) bool {
+	ua, err := normalizeUrl(a)
+	if err != nil {
+		return false
+	}
+	ub, err := normalizeUrl(b)
+	if err != nil {
+		return false
+	}
+	return ua == ub
+}
+
+func normalizeUrl(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", raw)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path, nil
+}
+
+func invalidProof(format string, args ...interface{}) error {
+	return errors.VerificationError(errors.ReasonInvalidProof, fmt.Errorf(format, args...))
+}
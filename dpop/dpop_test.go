@@ -0,0 +1,218 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package dpop
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/replay"
+	"github.com/stretchr/testify/require"
+)
+
+type client struct {
+	private, public jwk.Key
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	private, err := jwk.FromRaw(raw)
+	require.NoError(t, err)
+	public, err := private.PublicKey()
+	require.NoError(t, err)
+	return &client{private: private, public: public}
+}
+
+// proof signs claims, headerKey is embedded in the jwk header
+func (c *client) proof(t *testing.T, typ string, headerKey jwk.Key, claims map[string]interface{}) string {
+	t.Helper()
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.TypeKey, typ))
+	require.NoError(t, headers.Set(jws.JWKKey, headerKey))
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	proof, err := jws.Sign(payload, jws.WithKey(jwa.ES256, c.private, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return string(proof)
+}
+
+func proofClaims(jti string) map[string]interface{} {
+	return map[string]interface{}{
+		"jti": jti,
+		"htm": "GET",
+		"htu": "https://api.example.com/orders",
+		"iat": time.Now().Unix(),
+		"ath": tokenHash("access-token"),
+	}
+}
+
+func TestVerify(t *testing.T) {
+	v, err := (&Verifier{}).New()
+	require.NoError(t, err)
+	c := newClient(t)
+	ctx := context.Background()
+	verify := func(proof string) error {
+		_, err := v.Verify(ctx, proof, "GET", "https://API.example.com:443/orders?page=2", "access-token")
+		return err
+	}
+
+	proof, err := v.Verify(ctx, c.proof(t, ProofType, c.public, proofClaims("1")),
+		"GET", "https://API.example.com:443/orders?page=2", "access-token")
+	require.NoError(t, err)
+	thumbprint, err := Thumbprint(c.public)
+	require.NoError(t, err)
+	require.Equal(t, thumbprint, proof.Thumbprint)
+
+	// a proof is accepted once
+	replayed := c.proof(t, ProofType, c.public, proofClaims("2"))
+	require.NoError(t, verify(replayed))
+	require.Equal(t, errors.ReasonInvalidProof, errors.ReasonOf(verify(replayed)))
+
+	invalid := map[string]func(claims map[string]interface{}) string{
+		"type": func(claims map[string]interface{}) string {
+			return c.proof(t, "jwt", c.public, claims)
+		},
+		"private key": func(claims map[string]interface{}) string {
+			return c.proof(t, ProofType, c.private, claims)
+		},
+		"other key": func(claims map[string]interface{}) string {
+			return c.proof(t, ProofType, newClient(t).public, claims)
+		},
+		"method": func(claims map[string]interface{}) string {
+			claims["htm"] = "POST"
+			return c.proof(t, ProofType, c.public, claims)
+		},
+		"url": func(claims map[string]interface{}) string {
+			claims["htu"] = "https://api.example.com/users"
+			return c.proof(t, ProofType, c.public, claims)
+		},
+		"old": func(claims map[string]interface{}) string {
+			claims["iat"] = time.Now().Add(-time.Hour).Unix()
+			return c.proof(t, ProofType, c.public, claims)
+		},
+		"future": func(claims map[string]interface{}) string {
+			claims["iat"] = time.Now().Add(time.Minute).Unix()
+			return c.proof(t, ProofType, c.public, claims)
+		},
+		"access token": func(claims map[string]interface{}) string {
+			claims["ath"] = tokenHash("another-token")
+			return c.proof(t, ProofType, c.public, claims)
+		},
+		"no jti": func(claims map[string]interface{}) string {
+			delete(claims, "jti")
+			return c.proof(t, ProofType, c.public, claims)
+		},
+	}
+	for name, proof := range invalid {
+		t.Run(name, func(t *testing.T) {
+			err := verify(proof(proofClaims(name)))
+			require.Equal(t, errors.ReasonInvalidProof, errors.ReasonOf(err), err)
+		})
+	}
+}
+
+func TestVerifyBoundRequest(t *testing.T) {
+	v, err := (&Verifier{}).New()
+	require.NoError(t, err)
+	c := newClient(t)
+	thumbprint, err := Thumbprint(c.public)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "https://api.example.com/orders", nil)
+	r.Header.Set("DPoP", c.proof(t, ProofType, c.public, proofClaims("1")))
+	for _, claims := range []map[string]interface{}{nil, {"cnf": map[string]interface{}{"jkt": "other"}}} {
+		_, err = v.VerifyBoundRequest(r, "access-token", claims)
+		require.Equal(t, errors.ReasonBinding, errors.ReasonOf(err))
+	}
+	// the proofs of unbound tokens are not recorded
+	require.Zero(t, v.Replay.(*replay.Memory).Len())
+
+	_, err = v.VerifyBoundRequest(r, "access-token", map[string]interface{}{"cnf": map[string]interface{}{"jkt": thumbprint}})
+	require.NoError(t, err)
+}
+
+func TestVerifyNonce(t *testing.T) {
+	nonces, err := (&SignedNonces{}).New()
+	require.NoError(t, err)
+	v, err := (&Verifier{Nonces: nonces}).New()
+	require.NoError(t, err)
+	c := newClient(t)
+
+	r := httptest.NewRequest("GET", "https://api.example.com/orders", nil)
+	r.Header.Set("DPoP", c.proof(t, ProofType, c.public, proofClaims("1")))
+	_, err = v.VerifyRequest(r, "access-token")
+	require.Equal(t, errors.ReasonUseNonce, errors.ReasonOf(err))
+
+	claims := proofClaims("2")
+	claims["nonce"], err = nonces.Nonce()
+	require.NoError(t, err)
+	r.Header.Set("DPoP", c.proof(t, ProofType, c.public, claims))
+	_, err = v.VerifyRequest(r, "access-token")
+	require.NoError(t, err)
+}
+
+func TestSignedNonces(t *testing.T) {
+	nonces, err := (&SignedNonces{Lifetime: 20 * time.Millisecond}).New()
+	require.NoError(t, err)
+	nonce, err := nonces.Nonce()
+	require.NoError(t, err)
+	require.True(t, nonces.Valid(nonce))
+	require.False(t, nonces.Valid("forged"))
+
+	other, err := (&SignedNonces{}).New()
+	require.NoError(t, err)
+	require.False(t, other.Valid(nonce))
+
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, nonces.Valid(nonce))
+
+	// the zero value applies the defaults itself
+	zero := &SignedNonces{}
+	require.False(t, zero.Valid(nonce))
+	nonce, err = zero.Nonce()
+	require.NoError(t, err)
+	require.True(t, zero.Valid(nonce))
+	require.Equal(t, 5*time.Minute, zero.Lifetime)
+}
+
+func TestCheckBinding(t *testing.T) {
+	proof := &Proof{Thumbprint: "abc"}
+	require.NoError(t, CheckBinding(map[string]interface{}{"cnf": map[string]interface{}{"jkt": "abc"}}, proof))
+	err := CheckBinding(map[string]interface{}{"cnf": map[string]interface{}{"jkt": "def"}}, proof)
+	require.Equal(t, errors.ReasonBinding, errors.ReasonOf(err))
+	require.False(t, Bound(map[string]interface{}{}))
+}
+
+func TestSameUrl(t *testing.T) {
+	require.True(t, sameUrl("https://Example.com/a", "https://example.com:443/a?b=c#d"))
+	require.True(t, sameUrl("http://example.com", "http://example.com:80/"))
+	require.False(t, sameUrl("https://example.com/a", "http://example.com/a"))
+	require.False(t, sameUrl("https://example.com/a", "https://example.com/A"))
+	require.False(t, sameUrl("", "https://example.com/a"))
+}
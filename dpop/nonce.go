@@ -0,0 +1,107 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package dpop
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Nonces issues the nonces that clients must include in their proofs once
+// the server asked for them with a `DPoP-Nonce` header (RFC 9449 section 8).
+type Nonces interface {
+	// Nonce returns the nonce to send to clients
+	Nonce() (string, error)
+	// Valid reports whether a nonce was issued recently
+	Valid(nonce string) bool
+}
+
+// SignedNonces issues nonces that change every Lifetime, signed with Secret.
+// They need no storage, instances sharing the Secret accept each other's
+// nonces. A nonce stays valid until the end of the next period.
+//
+// The defaults are applied by New, or by the first call of Nonce or Valid,
+// so the zero value is ready to use.
+type SignedNonces struct {
+	// Secret defaults to random bytes, unique to the instance
+	Secret []byte
+	// Lifetime defaults to 5 minutes
+	Lifetime time.Duration
+
+	mutex sync.Mutex
+}
+
+func (n *SignedNonces) New() (*SignedNonces, error) {
+	if err := n.defaults(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *SignedNonces) Nonce() (string, error) {
+	if err := n.defaults(); err != nil {
+		return "", err
+	}
+	return n.sign(n.period()), nil
+}
+
+func (n *SignedNonces) Valid(nonce string) bool {
+	if n.defaults() != nil {
+		return false
+	}
+	period := n.period()
+	return hmac.Equal([]byte(nonce), []byte(n.sign(period))) ||
+		hmac.Equal([]byte(nonce), []byte(n.sign(period-1)))
+}
+
+// defaults sets the Secret and Lifetime that were not set
+func (n *SignedNonces) defaults() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if len(n.Secret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("could not generate a nonce secret: %w", err)
+		}
+		n.Secret = secret
+	}
+	if n.Lifetime == 0 {
+		n.Lifetime = 5 * time.Minute
+	}
+	return nil
+}
+
+func (n *SignedNonces) period() uint64 {
+	return uint64(time.Now().UnixNano() / int64(n.Lifetime))
+}
+
+func (n *SignedNonces) sign(period uint64) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, period)
+	mac := hmac.New(sha256.New, n.Secret)
+	mac.Write(buf)
+	return base64.RawURLEncoding.EncodeToString(append(buf, mac.Sum(nil)[:16]...))
+}
+
+// SignedNonces implements the Nonces interface
+var _ Nonces = (*SignedNonces)(nil)
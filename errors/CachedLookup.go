@@ -0,0 +1,46 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import (
+	"fmt"
+	"time"
+)
+
+// CachedLookup is returned in place of a lookup error that was cached, until
+// ExpiresAt the lookup is not attempted again.
+type CachedLookup struct {
+	Key       string
+	ExpiresAt time.Time
+	err       error
+}
+
+func CachedLookupError(key string, err error, expiresAt time.Time) *CachedLookup {
+	return &CachedLookup{
+		Key:       key,
+		ExpiresAt: expiresAt,
+		err:       err,
+	}
+}
+
+func (e *CachedLookup) Error() string {
+	return fmt.Sprintf("cached failure for %q until %s: %v", e.Key, e.ExpiresAt.Format(time.RFC3339), e.err)
+}
+
+func (e *CachedLookup) Unwrap() error {
+	return e.err
+}
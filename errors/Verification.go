@@ -0,0 +1,112 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package errors
+
+import stderrors "errors"
+
+// Reason classifies why a token failed verification.
+type Reason string
+
+const (
+	// ReasonMissing is a request that carries no token
+	ReasonMissing Reason = "missing_token"
+	// ReasonMalformed is a token that is not a well formed JWT
+	ReasonMalformed Reason = "malformed"
+	// ReasonMetadataUnavailable is an issuer whose metadata could not be fetched
+	ReasonMetadataUnavailable Reason = "metadata_unavailable"
+	// ReasonKeysUnavailable is an issuer whose key set could not be fetched
+	ReasonKeysUnavailable Reason = "keys_unavailable"
+	// ReasonIntrospectionUnavailable is an issuer whose introspection
+	// endpoint could not be reached or refused the client's credentials
+	ReasonIntrospectionUnavailable Reason = "introspection_unavailable"
+	// ReasonInactive is a token the introspection endpoint reports inactive
+	ReasonInactive Reason = "inactive"
+	// ReasonTokenType is a token the introspection endpoint reports active
+	// but that is not an access token, such as a refresh token
+	ReasonTokenType Reason = "invalid_token_type"
+	// ReasonRevoked is a token whose jti, sub or sid was revoked
+	ReasonRevoked Reason = "revoked"
+	// ReasonRevocationUnavailable is a revocation store that could not be
+	// consulted
+	ReasonRevocationUnavailable Reason = "revocation_unavailable"
+	// ReasonReplayed is a token that was already used once
+	ReasonReplayed Reason = "replayed"
+	// ReasonReplayUnavailable is a replay store that could not be consulted
+	ReasonReplayUnavailable Reason = "replay_unavailable"
+	// ReasonInvalidProof is a DPoP proof that is missing or invalid
+	ReasonInvalidProof Reason = "invalid_dpop_proof"
+	// ReasonUseNonce is a DPoP proof without a valid server issued nonce
+	ReasonUseNonce Reason = "use_dpop_nonce"
+	// ReasonBinding is an access token that is not bound to the key of the
+	// client presenting it, or a bound token presented as a bearer token
+	ReasonBinding Reason = "invalid_binding"
+	// ReasonLogoutToken is a token that lacks the type or claims of a logout
+	// token, or has a nonce
+	ReasonLogoutToken Reason = "invalid_logout_token"
+	// ReasonSignature is a token whose signature could not be verified
+	ReasonSignature Reason = "invalid_signature"
+	ReasonIssuer    Reason = "invalid_issuer"
+	ReasonAudience  Reason = "invalid_audience"
+	ReasonClientId  Reason = "invalid_client_id"
+	ReasonExpired   Reason = "expired"
+	ReasonIssuedAt  Reason = "issued_in_future"
+	ReasonNonce     Reason = "invalid_nonce"
+)
+
+// Verification is returned when a token fails verification. Its message is
+// the message of the error it wraps.
+type Verification struct {
+	Reason Reason
+	err    error
+}
+
+func VerificationError(reason Reason, err error) *Verification {
+	return &Verification{
+		Reason: reason,
+		err:    err,
+	}
+}
+
+func (e *Verification) Error() string {
+	return e.err.Error()
+}
+
+func (e *Verification) Unwrap() error {
+	return e.err
+}
+
+// ReasonOf returns the Reason of the first Verification error in err's chain,
+// or an empty Reason when there is none.
+func ReasonOf(err error) Reason {
+	var v *Verification
+	if stderrors.As(err, &v) {
+		return v.Reason
+	}
+	return ""
+}
+
+// Unavailable reports whether the reason is a failure to reach the issuer
+// rather than a problem with the token.
+func (r Reason) Unavailable() bool {
+	switch r {
+	case ReasonMetadataUnavailable, ReasonKeysUnavailable, ReasonIntrospectionUnavailable, ReasonRevocationUnavailable,
+		ReasonReplayUnavailable:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,147 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package events
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+)
+
+// DefaultFailingAfter is the number of consecutive failed requests to the
+// same url after which FetchFailing is called
+const DefaultFailingAfter = 3
+
+// Handlers are callbacks for events of the verifier's lifecycle. Nil
+// callbacks are skipped. They are called synchronously, from the goroutine
+// that detected the event, and should return quickly.
+type Handlers struct {
+	// KeySetChanged is called when a key set is fetched again with different
+	// key ids
+	KeySetChanged func(KeySetChange)
+	// MetadataChanged is called when the discovery document is fetched again
+	// with different content
+	MetadataChanged func(MetadataChange)
+	// FetchFailing is called for every failed request to a url once
+	// FailingAfter requests to it have failed in a row
+	FetchFailing func(FetchFailure)
+	// UnknownKeyId is called when a token is signed with a key id missing
+	// from the key set
+	UnknownKeyId func(UnknownKeyId)
+	// VerificationFailed is called when a token is rejected
+	VerificationFailed func(VerificationFailure)
+
+	// FailingAfter defaults to DefaultFailingAfter
+	FailingAfter int
+}
+
+// KeySetChange lists the key ids added to and removed from a key set.
+type KeySetChange struct {
+	Issuer  string
+	JwksUri string
+	Added   []string
+	Removed []string
+}
+
+// MetadataChange lists the top-level fields of the discovery document that
+// were added, removed or modified.
+type MetadataChange struct {
+	Issuer   string
+	Url      string
+	Fields   []string
+	Previous map[string]interface{}
+	Current  map[string]interface{}
+}
+
+// FetchFailure is a failed request to the issuer. StatusCode is zero when
+// the issuer did not answer.
+type FetchFailure struct {
+	Issuer              string
+	Url                 string
+	StatusCode          int
+	Err                 error
+	ConsecutiveFailures int
+}
+
+// UnknownKeyId is a token signed with a key the issuer does not publish.
+type UnknownKeyId struct {
+	Issuer  string
+	JwksUri string
+	KeyId   string
+}
+
+// VerificationFailure is a rejected token.
+type VerificationFailure struct {
+	Issuer    string
+	TokenType string
+	KeyId     string
+	Reason    errors.Reason
+	Err       error
+}
+
+// FailureCounter counts consecutive failed requests per url to report them
+// to FetchFailing.
+type FailureCounter struct {
+	mutex    sync.Mutex
+	failures map[string]int
+}
+
+// Record records the outcome of a request to url of issuer, and calls
+// h.FetchFailing when it is one too many failures in a row.
+func (c *FailureCounter) Record(h Handlers, issuer, url string, statusCode int, err error) {
+	failed := err != nil || statusCode < 200 || statusCode >= 400
+	c.mutex.Lock()
+	if c.failures == nil {
+		c.failures = map[string]int{}
+	}
+	if !failed {
+		delete(c.failures, url)
+		c.mutex.Unlock()
+		return
+	}
+	c.failures[url]++
+	count := c.failures[url]
+	c.mutex.Unlock()
+
+	threshold := h.FailingAfter
+	if threshold <= 0 {
+		threshold = DefaultFailingAfter
+	}
+	if h.FetchFailing != nil && count >= threshold {
+		h.FetchFailing(FetchFailure{Issuer: issuer, Url: url, StatusCode: statusCode, Err: err, ConsecutiveFailures: count})
+	}
+}
+
+// ChangedFields returns the sorted top-level keys whose values differ
+// between previous and current.
+func ChangedFields(previous, current map[string]interface{}) []string {
+	var changed []string
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || !reflect.DeepEqual(old, value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,50 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedFields(t *testing.T) {
+	previous := map[string]interface{}{"issuer": "a", "jwks_uri": "b", "scopes": []interface{}{"openid"}}
+	current := map[string]interface{}{"issuer": "a", "scopes": []interface{}{"openid", "email"}, "extra": true}
+	require.Equal(t, []string{"extra", "jwks_uri", "scopes"}, ChangedFields(previous, current))
+	require.Empty(t, ChangedFields(previous, previous))
+}
+
+func TestFailureCounterResetsOnSuccess(t *testing.T) {
+	var counts []int
+	var issuers []string
+	h := Handlers{FetchFailing: func(e FetchFailure) {
+		counts = append(counts, e.ConsecutiveFailures)
+		issuers = append(issuers, e.Issuer)
+	}}
+	var c FailureCounter
+
+	for i := 0; i < 3; i++ {
+		c.Record(h, "https://issuer", "https://a", 500, nil)
+	}
+	c.Record(h, "https://issuer", "https://b", 0, nil)
+	c.Record(h, "https://issuer", "https://a", 304, nil)
+	c.Record(h, "https://issuer", "https://a", 500, nil)
+
+	require.Equal(t, []int{3}, counts)
+	require.Equal(t, []string{"https://issuer"}, issuers)
+}
@@ -0,0 +1,128 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/events"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsReportKeyAndMetadataChanges(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	oldKey, newKey := testissuer.NewKey(t, "kid-1"), testissuer.NewKey(t, "kid-2")
+	testissuer.Register(t, oldKey)
+
+	var keyChanges []events.KeySetChange
+	var metadataChanges []events.MetadataChange
+	jvs := JwtVerifier{
+		Issuer: testIssuer,
+		Events: events.Handlers{
+			KeySetChanged:   func(e events.KeySetChange) { keyChanges = append(keyChanges, e) },
+			MetadataChanged: func(e events.MetadataChange) { metadataChanges = append(metadataChanges, e) },
+		},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(oldKey.Sign(t, validClaims()))
+	require.NoError(t, err)
+
+	testissuer.Register(t, newKey)
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		httpmock.NewStringResponder(200, `{"issuer":"`+testIssuer+`","jwks_uri":"`+testIssuer+`/v1/keys","end_session_endpoint":"`+testIssuer+`/v1/logout"}`))
+	require.NoError(t, jv.InvalidateMetadata())
+	require.NoError(t, jv.InvalidateKeys())
+	_, err = jv.VerifyAccessToken(newKey.Sign(t, validClaims()))
+	require.NoError(t, err)
+
+	require.Len(t, keyChanges, 1)
+	require.Equal(t, testIssuer, keyChanges[0].Issuer)
+	require.Equal(t, testIssuer+"/v1/keys", keyChanges[0].JwksUri)
+	require.Equal(t, []string{"kid-2"}, keyChanges[0].Added)
+	require.Equal(t, []string{"kid-1"}, keyChanges[0].Removed)
+
+	require.Len(t, metadataChanges, 1)
+	require.Equal(t, testIssuer, metadataChanges[0].Issuer)
+	require.Equal(t, []string{"end_session_endpoint"}, metadataChanges[0].Fields)
+}
+
+func TestEventsReportRepeatedFetchFailures(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		httpmock.NewStringResponder(503, `{}`))
+
+	var failures []events.FetchFailure
+	jvs := JwtVerifier{
+		Issuer: testIssuer,
+		Retry:  &utils.RetryPolicy{MaxAttempts: 1},
+		Events: events.Handlers{
+			FetchFailing: func(e events.FetchFailure) { failures = append(failures, e) },
+			FailingAfter: 2,
+		},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	token := testissuer.NewKey(t, "kid-1").Sign(t, validClaims())
+	for i := 0; i < 3; i++ {
+		require.NoError(t, jv.InvalidateMetadata())
+		_, err = jv.VerifyAccessToken(token)
+		require.Error(t, err)
+	}
+
+	require.Len(t, failures, 2)
+	require.Equal(t, testIssuer, failures[0].Issuer)
+	require.Equal(t, 503, failures[0].StatusCode)
+	require.Equal(t, 2, failures[0].ConsecutiveFailures)
+	require.Equal(t, 3, failures[1].ConsecutiveFailures)
+}
+
+func TestEventsReportUnknownKeyIdAndFailures(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	testissuer.Register(t, testissuer.NewKey(t, "kid-1"))
+
+	var unknown []events.UnknownKeyId
+	var failed []events.VerificationFailure
+	jvs := JwtVerifier{
+		Issuer: testIssuer,
+		Events: events.Handlers{
+			UnknownKeyId:       func(e events.UnknownKeyId) { unknown = append(unknown, e) },
+			VerificationFailed: func(e events.VerificationFailure) { failed = append(failed, e) },
+		},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(testissuer.NewKey(t, "kid-9").Sign(t, validClaims()))
+	require.Error(t, err)
+
+	require.Len(t, unknown, 1)
+	require.Equal(t, testIssuer, unknown[0].Issuer)
+	require.Equal(t, "kid-9", unknown[0].KeyId)
+	require.Len(t, failed, 1)
+	require.Equal(t, "access_token", failed[0].TokenType)
+	require.Equal(t, "kid-9", failed[0].KeyId)
+	require.Equal(t, errors.ReasonSignature, failed[0].Reason)
+}
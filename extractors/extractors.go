@@ -0,0 +1,165 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package extractors
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Extractor finds the token sent with a request. It returns an empty string
+// when the request has none, and an error when the request carries a token in
+// a way that is not accepted.
+type Extractor interface {
+	Extract(r *http.Request) (string, error)
+}
+
+// ExtractorFunc adapts a function to an Extractor.
+type ExtractorFunc func(r *http.Request) (string, error)
+
+func (f ExtractorFunc) Extract(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// AuthorizationHeader extracts the token of an `Authorization: Bearer`
+// header (RFC 6750 section 2.1). The scheme is matched case-insensitively.
+func AuthorizationHeader() Extractor {
+	return Header("Authorization", "Bearer")
+}
+
+// Header extracts the token of the header name. When scheme is set the header
+// must be the scheme followed by the token, otherwise the whole value is the
+// token.
+func Header(name, scheme string) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			return "", nil
+		}
+		if len(values) > 1 {
+			return "", fmt.Errorf("the request has more than one %s header", name)
+		}
+		token := strings.TrimSpace(values[0])
+		if scheme != "" {
+			prefix, rest, found := strings.Cut(token, " ")
+			if !found || !strings.EqualFold(prefix, scheme) {
+				return "", fmt.Errorf("the %s header must use the %s scheme", name, scheme)
+			}
+			token = strings.TrimSpace(rest)
+		}
+		if token == "" || strings.ContainsAny(token, " \t") {
+			return "", fmt.Errorf("the %s header must contain a single token", name)
+		}
+		return token, nil
+	})
+}
+
+// Cookie extracts the token of the cookie name.
+func Cookie(name string) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return "", nil
+		}
+		return cookie.Value, nil
+	})
+}
+
+// Form extracts the token of the form field name of a
+// `application/x-www-form-urlencoded` request body (RFC 6750 section 2.2).
+// Other requests are ignored.
+func Form(name string) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		if r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return "", nil
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" {
+			return "", nil
+		}
+		if err := r.ParseForm(); err != nil {
+			return "", fmt.Errorf("the request body is not a valid form: %w", err)
+		}
+		values := r.PostForm[name]
+		if len(values) > 1 {
+			return "", fmt.Errorf("the request has more than one %s form field", name)
+		}
+		if len(values) == 0 {
+			return "", nil
+		}
+		return values[0], nil
+	})
+}
+
+// Query extracts the token of the query parameter Name (RFC 6750 section
+// 2.3). Tokens in URLs end up in access logs and browser history, so they
+// are refused with an error unless Allow is set. Responses to requests
+// authenticated this way should carry `Cache-Control: private`.
+type Query struct {
+	Name  string
+	Allow bool
+}
+
+func (q Query) Extract(r *http.Request) (string, error) {
+	values, found := r.URL.Query()[q.Name]
+	if !found {
+		return "", nil
+	}
+	if !q.Allow {
+		return "", fmt.Errorf("tokens in the %s query parameter are not accepted", q.Name)
+	}
+	if len(values) > 1 {
+		return "", fmt.Errorf("the request has more than one %s query parameter", q.Name)
+	}
+	return values[0], nil
+}
+
+// WebSocketProtocol extracts the token of a `Sec-WebSocket-Protocol` entry
+// starting with prefix, such as "access_token." for browsers, which cannot
+// set headers on WebSocket upgrades.
+func WebSocketProtocol(prefix string) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+			for _, protocol := range strings.Split(value, ",") {
+				protocol = strings.TrimSpace(protocol)
+				if strings.HasPrefix(protocol, prefix) {
+					return strings.TrimPrefix(protocol, prefix), nil
+				}
+			}
+		}
+		return "", nil
+	})
+}
+
+// Chain tries each extractor in order and returns the first token found. An
+// error of any extractor stops the chain.
+func Chain(extractors ...Extractor) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		for _, e := range extractors {
+			token, err := e.Extract(r)
+			if err != nil || token != "" {
+				return token, err
+			}
+		}
+		return "", nil
+	})
+}
+
+// Query is an Extractor
+var _ Extractor = Query{}
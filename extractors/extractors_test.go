@@ -0,0 +1,115 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package extractors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	token, err := AuthorizationHeader().Extract(req)
+	require.NoError(t, err)
+	require.Empty(t, token)
+
+	req.Header.Set("Authorization", "BEARER abc")
+	token, err = AuthorizationHeader().Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", token)
+
+	for _, header := range []string{"Basic abc", "Bearer", "Bearer a b"} {
+		req.Header.Set("Authorization", header)
+		_, err = AuthorizationHeader().Extract(req)
+		require.Error(t, err, header)
+	}
+}
+
+func TestHeaderWithoutScheme(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Access-Token", " abc ")
+	token, err := Header("X-Access-Token", "").Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", token)
+}
+
+func TestCookie(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: "abc"})
+	token, err := Cookie("access_token").Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", token)
+
+	token, err = Cookie("other").Extract(req)
+	require.NoError(t, err)
+	require.Empty(t, token)
+}
+
+func TestForm(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"access_token": {"abc"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token, err := Form("access_token").Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", token)
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"access_token":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	token, err = Form("access_token").Extract(req)
+	require.NoError(t, err)
+	require.Empty(t, token)
+}
+
+func TestQueryIsRefusedUnlessAllowed(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?access_token=abc", nil)
+	_, err := Query{Name: "access_token"}.Extract(req)
+	require.ErrorContains(t, err, "not accepted")
+
+	token, err := Query{Name: "access_token", Allow: true}.Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", token)
+}
+
+func TestWebSocketProtocol(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "chat, access_token.abc")
+	token, err := WebSocketProtocol("access_token.").Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "abc", token)
+}
+
+func TestChain(t *testing.T) {
+	chain := Chain(AuthorizationHeader(), Cookie("access_token"), Query{Name: "access_token"})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: "from-cookie"})
+	token, err := chain.Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "from-cookie", token)
+
+	req.Header.Set("Authorization", "Bearer from-header")
+	token, err = chain.Extract(req)
+	require.NoError(t, err)
+	require.Equal(t, "from-header", token)
+
+	_, err = chain.Extract(httptest.NewRequest(http.MethodGet, "/?access_token=abc", nil))
+	require.Error(t, err)
+}
@@ -0,0 +1,181 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package grpcauth
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"strings"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang/v2"
+	"github.com/okta/okta-jwt-verifier-golang/v2/dpop"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/middleware"
+	"github.com/okta/okta-jwt-verifier-golang/v2/mtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// HealthAndReflection are the standard gRPC health checking and reflection
+// services, which are commonly excluded from authentication
+var HealthAndReflection = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// Interceptor authenticates gRPC calls with the access token of their
+// `authorization` metadata and stores the verified token in the call
+// context, see JwtFromContext.
+//
+// Calls fail with:
+//   - Unauthenticated when the token is missing, malformed or rejected, is
+//     bound to a DPoP key, or is bound to a client certificate (RFC 8705) the
+//     caller did not present over TLS
+//   - PermissionDenied when the token lacks one of the method's Scopes
+//   - Unavailable when the issuer's metadata or keys cannot be fetched
+type Interceptor struct {
+	Verifier *jwtverifier.JwtVerifier
+	// Scopes maps full method names, such as "/pkg.Service/Method", to the
+	// scopes the token must be granted to call them
+	Scopes map[string][]string
+	// Exclude lists the full method names served without authentication. An
+	// entry ending with "/" excludes every method of a service.
+	Exclude []string
+}
+
+// JwtFromContext returns the token verified by the interceptor, if any.
+func JwtFromContext(ctx context.Context) (*jwtverifier.Jwt, bool) {
+	return middleware.JwtFromContext(ctx)
+}
+
+// Unary returns the interceptor for unary calls.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor for streaming calls.
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (i *Interceptor) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if i.excluded(method) {
+		return ctx, nil
+	}
+
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	jwt, err := i.Verifier.VerifyAccessTokenContext(ctx, token)
+	if err != nil {
+		reason := errors.ReasonOf(err)
+		if reason.Unavailable() {
+			return nil, status.Error(codes.Unavailable, "the access token cannot be verified at the moment")
+		}
+		if reason == "" {
+			reason = "invalid"
+		}
+		return nil, status.Errorf(codes.Unauthenticated, "the access token is not valid: %s", reason)
+	}
+	// a DPoP-bound token must not be accepted as a bearer token (RFC 9449
+	// section 7.1), and calls carry no DPoP proof
+	if dpop.Bound(jwt.Claims) {
+		return nil, status.Errorf(codes.Unauthenticated, "the access token is not valid: %s", errors.ReasonBinding)
+	}
+	if mtls.Bound(jwt.Claims) {
+		if err := mtls.CheckConnection(jwt.Claims, peerTLS(ctx)); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "the access token is not valid: %s", errors.ReasonOf(err))
+		}
+	}
+
+	if missing := middleware.MissingScopes(jwt, i.Scopes[method]); len(missing) > 0 {
+		return nil, status.Errorf(codes.PermissionDenied, "the access token is missing the scopes: %s", strings.Join(missing, " "))
+	}
+
+	return middleware.ContextWithJwt(ctx, jwt), nil
+}
+
+func (i *Interceptor) excluded(method string) bool {
+	for _, e := range i.Exclude {
+		if e == method || (strings.HasSuffix(e, "/") && strings.HasPrefix(method, e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the `authorization` metadata
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	switch {
+	case len(values) == 0:
+		return "", stderrors.New("the call has no authorization metadata")
+	case len(values) > 1:
+		return "", stderrors.New("the call has more than one authorization metadata")
+	}
+	scheme, token, found := strings.Cut(strings.TrimSpace(values[0]), " ")
+	token = strings.TrimSpace(token)
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", stderrors.New("the authorization metadata must be a Bearer token")
+	}
+	return token, nil
+}
+
+// peerTLS returns the TLS connection state of the caller, or nil when the
+// call was not made over TLS
+func peerTLS(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return &info.State
+}
+
+// serverStream overrides the context of a stream with the authenticated one
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
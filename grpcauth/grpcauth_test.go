@@ -0,0 +1,178 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package grpcauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testverifier"
+	"github.com/okta/okta-jwt-verifier-golang/v2/mtls"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const testIssuer = testissuer.Issuer
+
+func withAuthorization(values ...string) context.Context {
+	md := metadata.MD{}
+	for _, v := range values {
+		md.Append("authorization", v)
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+// subject answers with the subject of the verified token
+func subject(ctx context.Context, _ interface{}) (interface{}, error) {
+	jwt, ok := JwtFromContext(ctx)
+	if !ok {
+		return "anonymous", nil
+	}
+	return jwt.Claims["sub"], nil
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	interceptor := &Interceptor{
+		Verifier: jv,
+		Scopes:   map[string][]string{"/orders.Orders/Cancel": {"orders:write"}},
+		Exclude:  HealthAndReflection,
+	}
+	unary := interceptor.Unary()
+	call := func(ctx context.Context, method string) (interface{}, error) {
+		return unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, subject)
+	}
+
+	resp, err := call(withAuthorization("bearer "+sign(testissuer.Claims("orders:read"))), "/orders.Orders/Get")
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", resp)
+
+	_, err = call(withAuthorization("Bearer "+sign(testissuer.Claims("orders:read"))), "/orders.Orders/Cancel")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	resp, err = call(withAuthorization("Bearer "+sign(testissuer.Claims("orders:write"))), "/orders.Orders/Cancel")
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", resp)
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		withAuthorization("Basic dXNlcjpwYXNz"),
+		withAuthorization("Bearer a", "Bearer b"),
+		withAuthorization("Bearer not.a.token"),
+	} {
+		_, err = call(ctx, "/orders.Orders/Get")
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	resp, err = call(context.Background(), "/grpc.health.v1.Health/Check")
+	require.NoError(t, err)
+	require.Equal(t, "anonymous", resp)
+}
+
+func TestUnaryInterceptorRejectsDPoPBoundTokens(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	bound := testissuer.Claims()
+	bound["cnf"] = map[string]interface{}{"jkt": "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"}
+
+	_, err := (&Interceptor{Verifier: jv}).Unary()(withAuthorization("Bearer "+sign(bound)), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Get"}, subject)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// withPeerCertificate returns a copy of ctx for a call made over TLS with
+// cert, or without TLS when cert is nil
+func withPeerCertificate(ctx context.Context, cert *x509.Certificate) context.Context {
+	if cert == nil {
+		return ctx
+	}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestUnaryInterceptorChecksCertificateBinding(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	cert := testissuer.NewCertificate(t)
+	bound := testissuer.Claims()
+	bound["cnf"] = map[string]interface{}{mtls.ConfirmationMethod: mtls.Thumbprint(cert)}
+	token := sign(bound)
+	unary := (&Interceptor{Verifier: jv}).Unary()
+	info := &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Get"}
+
+	resp, err := unary(withPeerCertificate(withAuthorization("Bearer "+token), cert), nil, info, subject)
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", resp)
+
+	for name, presented := range map[string]*x509.Certificate{"none": nil, "other": testissuer.NewCertificate(t)} {
+		_, err = unary(withPeerCertificate(withAuthorization("Bearer "+token), presented), nil, info, subject)
+		require.Equal(t, codes.Unauthenticated, status.Code(err), name)
+	}
+}
+
+func TestUnaryInterceptorIssuerUnavailable(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	httpmock.RegisterResponder("GET", testIssuer+"/v1/keys", httpmock.NewStringResponder(500, ``))
+
+	_, err := (&Interceptor{Verifier: jv}).Unary()(withAuthorization("Bearer "+sign(testissuer.Claims())), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/orders.Orders/Get"}, subject)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// fakeStream is a server stream with only a context
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	stream := (&Interceptor{Verifier: jv}).Stream()
+	info := &grpc.StreamServerInfo{FullMethod: "/orders.Orders/Watch"}
+
+	var sub interface{}
+	handler := func(_ interface{}, ss grpc.ServerStream) error {
+		sub, _ = subject(ss.Context(), nil)
+		return nil
+	}
+
+	require.NoError(t, stream(nil, &fakeStream{ctx: withAuthorization("Bearer " + sign(testissuer.Claims()))}, info, handler))
+	require.Equal(t, "user@example.com", sub)
+
+	err := stream(nil, &fakeStream{ctx: context.Background()}, info, handler)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
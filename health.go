@@ -0,0 +1,137 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/adaptors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+)
+
+type metadataStatus struct {
+	fetchedAt time.Time
+	jwksUri   string
+	metadata  map[string]interface{}
+}
+
+// Health reports on the data the verifier has fetched from the issuer.
+type Health struct {
+	// Ready is true once both the metadata and the key set have been fetched
+	Ready bool `json:"ready"`
+	// Stale is true when the cached data has expired and will be fetched
+	// again by the next verification. Caches that cannot tell when their
+	// entries expire are assumed to keep them for the cache Timeout.
+	Stale bool `json:"stale"`
+	// MetadataFetchedAt and KeysFetchedAt are nil until the first fetch
+	MetadataFetchedAt *time.Time `json:"metadataFetchedAt,omitempty"`
+	KeysFetchedAt     *time.Time `json:"keysFetchedAt,omitempty"`
+	KeyIds            []string   `json:"keyIds,omitempty"`
+}
+
+// Warmup fetches the issuer's metadata and key set so that the first
+// verification does not pay for them, and so that a misconfigured issuer is
+// reported at startup rather than on the first request.
+func (j *JwtVerifier) Warmup(ctx context.Context) error {
+	metadata, err := j.getMetaDataContext(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch metadata for issuer %q: %w", j.Issuer, err)
+	}
+	jwksURI, ok := metadata["jwks_uri"].(string)
+	if !ok {
+		return fmt.Errorf("missing 'jwks_uri' from metadata for issuer %q", j.Issuer)
+	}
+
+	warmer, ok := j.Adaptor.(adaptors.Warmer)
+	if !ok {
+		return nil
+	}
+	if err := warmer.Warmup(ctx, jwksURI); err != nil {
+		return fmt.Errorf("could not fetch keys from %q for issuer %q: %w", jwksURI, j.Issuer, err)
+	}
+	return nil
+}
+
+// Health reports when the metadata and key set were last fetched without
+// making any requests.
+func (j *JwtVerifier) Health() Health {
+	health := Health{}
+	status, ok := j.metadataStatus.Load().(metadataStatus)
+	if !ok {
+		return health
+	}
+	health.MetadataFetchedAt = &status.fetchedAt
+	health.Stale = j.metadataStale(status.fetchedAt)
+
+	reporter, ok := j.Adaptor.(adaptors.StatusReporter)
+	if !ok {
+		// the adaptor cannot tell, assume its keys are usable
+		health.Ready = true
+		return health
+	}
+	keys, ok := reporter.KeySetStatus(status.jwksUri)
+	if !ok {
+		return health
+	}
+	health.Ready = true
+	health.KeysFetchedAt = &keys.FetchedAt
+	health.KeyIds = keys.KeyIds
+	health.Stale = health.Stale || expired(keys.FetchedAt, keys.ExpiresAt, j.Timeout)
+	return health
+}
+
+// metadataStale reports whether the discovery document fetched at fetchedAt
+// has expired from the metadata cache
+func (j *JwtVerifier) metadataStale(fetchedAt time.Time) bool {
+	cache, ok := j.metadataCache.(utils.ManagedCacher)
+	if !ok {
+		return expired(fetchedAt, time.Time{}, j.Timeout)
+	}
+	metaDataUrl, _ := j.metadataUrl.Load().(string)
+	entry, found := cache.Peek(metaDataUrl)
+	if !found || entry.Err != nil {
+		return true
+	}
+	return expired(fetchedAt, entry.ExpiresAt, j.Timeout)
+}
+
+// expired reports whether a value fetched at fetchedAt has expired, at
+// expiresAt or, when that is unknown, after timeout
+func expired(fetchedAt, expiresAt time.Time, timeout time.Duration) bool {
+	if expiresAt.IsZero() {
+		return time.Since(fetchedAt) > timeout
+	}
+	return !time.Now().Before(expiresAt)
+}
+
+// HealthHandler returns an http.Handler that writes Health as JSON, with a
+// 503 status until the verifier is ready. It can be used as a readiness
+// probe.
+func (j *JwtVerifier) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := j.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(health)
+	})
+}
@@ -0,0 +1,121 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmupPopulatesCaches(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{Issuer: testIssuer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	require.False(t, jv.Health().Ready)
+	require.NoError(t, jv.Warmup(context.Background()))
+
+	health := jv.Health()
+	require.True(t, health.Ready)
+	require.False(t, health.Stale)
+	require.Equal(t, []string{"kid-1"}, health.KeyIds)
+	require.NotNil(t, health.MetadataFetchedAt)
+	require.NotNil(t, health.KeysFetchedAt)
+
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.NoError(t, err)
+	require.Equal(t, 2, httpmock.GetTotalCallCount())
+}
+
+func TestWarmupReportsMisconfiguredIssuer(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		httpmock.NewStringResponder(404, `{}`))
+
+	jvs := JwtVerifier{Issuer: testIssuer}
+	jv, _ := jvs.New()
+
+	err := jv.Warmup(context.Background())
+	require.ErrorContains(t, err, "could not fetch metadata for issuer \""+testIssuer+"\"")
+	require.ErrorContains(t, err, "it was: 404")
+}
+
+func TestHealthHandler(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	testissuer.Register(t, testissuer.NewKey(t, "kid-1"))
+
+	jvs := JwtVerifier{Issuer: testIssuer}
+	jv, _ := jvs.New()
+
+	rec := httptest.NewRecorder()
+	jv.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"ready":false,"stale":false}`, rec.Body.String())
+
+	require.NoError(t, jv.Warmup(context.Background()))
+	rec = httptest.NewRecorder()
+	jv.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"keyIds":["kid-1"]`)
+}
+
+func TestHealthHonorsCacheExpiry(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []interface{}{key.Public}})
+	require.NoError(t, err)
+	// the issuer lets its documents be cached for an hour
+	cached := func(body string) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(200, body)
+			resp.Header.Set("Cache-Control", "max-age=3600")
+			return resp, nil
+		}
+	}
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		cached(`{"issuer":"`+testIssuer+`","jwks_uri":"`+testIssuer+`/v1/keys"}`))
+	httpmock.RegisterResponder("GET", testIssuer+"/v1/keys", cached(string(jwks)))
+
+	jvs := JwtVerifier{Issuer: testIssuer, Timeout: 20 * time.Millisecond, MinTimeout: time.Millisecond, MaxTimeout: time.Hour}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	require.NoError(t, jv.Warmup(context.Background()))
+
+	time.Sleep(50 * time.Millisecond)
+	health := jv.Health()
+	require.True(t, health.Ready)
+	require.False(t, health.Stale)
+
+	require.NoError(t, jv.InvalidateKeys())
+	require.True(t, jv.Health().Stale)
+}
@@ -0,0 +1,141 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package testissuer mocks an issuer, signs its tokens and creates the client
+// certificates they are bound to, for the tests of this repository.
+package testissuer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Issuer is the issuer mocked by Register
+	Issuer = "https://example.com/oauth2/default"
+	// Audience is the audience of the tokens returned by Claims
+	Audience = "api://default"
+)
+
+// Claims returns the claims of a valid access token of Issuer granted scopes
+func Claims(scopes ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": Issuer,
+		"aud": Audience,
+		"sub": "user@example.com",
+		"scp": scopes,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// Key is an RSA signing key published by the mocked issuer
+type Key struct {
+	Private jwk.Key
+	Public  jwk.Key
+}
+
+// NewKey returns an RS256 key identified by kid.
+func NewKey(t testing.TB, kid string) *Key {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	private, err := jwk.FromRaw(raw)
+	require.NoError(t, err)
+	require.NoError(t, private.Set(jwk.KeyIDKey, kid))
+	require.NoError(t, private.Set(jwk.AlgorithmKey, jwa.RS256))
+	public, err := private.PublicKey()
+	require.NoError(t, err)
+	return &Key{Private: private, Public: public}
+}
+
+// Sign returns a compact JWS of claims signed with the key.
+func (k *Key) Sign(t testing.TB, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	token, err := jws.Sign(payload, jws.WithKey(jwa.RS256, k.Private))
+	require.NoError(t, err)
+	return string(token)
+}
+
+// SignTyped returns a compact JWS of claims with the typ header.
+func (k *Key) SignTyped(t testing.TB, typ string, claims map[string]interface{}) string {
+	t.Helper()
+	headers := jws.NewHeaders()
+	require.NoError(t, headers.Set(jws.TypeKey, typ))
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	token, err := jws.Sign(payload, jws.WithKey(jwa.RS256, k.Private, jws.WithProtectedHeaders(headers)))
+	require.NoError(t, err)
+	return string(token)
+}
+
+// Register mocks the discovery document and key set of Issuer on the default
+// httpmock transport.
+func Register(t testing.TB, keys ...*Key) {
+	t.Helper()
+	RegisterOn(t, httpmock.DefaultTransport, keys...)
+}
+
+// RegisterOn mocks Issuer on a transport of its own, for tests whose
+// requests may outlive them.
+func RegisterOn(t testing.TB, mock *httpmock.MockTransport, keys ...*Key) {
+	t.Helper()
+	set := jwk.NewSet()
+	for _, k := range keys {
+		require.NoError(t, set.AddKey(k.Public))
+	}
+	jwks, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	mock.RegisterResponder("GET", Issuer+"/.well-known/openid-configuration",
+		httpmock.NewStringResponder(200, `{"issuer":"`+Issuer+`","jwks_uri":"`+Issuer+`/v1/keys"}`))
+	mock.RegisterResponder("GET", Issuer+"/v1/keys",
+		httpmock.NewBytesResponder(200, jwks))
+}
+
+// NewCertificate returns a self-signed client certificate.
+func NewCertificate(t testing.TB) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
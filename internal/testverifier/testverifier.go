@@ -0,0 +1,51 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+// Package testverifier creates verifiers of the issuer mocked by testissuer,
+// for the tests of the packages built on the verifier. It is separate from
+// testissuer, which the tests of the verifier itself import.
+package testverifier
+
+import (
+	"testing"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang/v2"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// New mocks testissuer.Issuer with a new key and returns a verifier of its
+// access tokens for testissuer.Audience, along with a function signing tokens
+// with the key
+func New(t *testing.T) (*jwtverifier.JwtVerifier, func(map[string]interface{}) string) {
+	t.Helper()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := jwtverifier.JwtVerifier{
+		Issuer:           testissuer.Issuer,
+		ClaimsToValidate: map[string]string{"aud": testissuer.Audience},
+		Retry:            &utils.RetryPolicy{MaxAttempts: 1},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	sign := func(claims map[string]interface{}) string {
+		return key.Sign(t, claims)
+	}
+	return jv, sign
+}
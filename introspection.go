@@ -0,0 +1,283 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/patrickmn/go-cache"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Introspector verifies access tokens by asking the issuer's introspection
+// endpoint (RFC 7662). It handles opaque tokens and the tokens of Okta's org
+// authorization server, which cannot be verified locally.
+//
+// The client authenticates with ClientSecret (`client_secret_basic`), or with
+// PrivateKey (`private_key_jwt`) when it is set. Active results are cached
+// until the token expires, inactive ones for the verifier's ErrorTimeout.
+// Each request is bounded by the verifier's FetchTimeout.
+type Introspector struct {
+	// Verifier provides the issuer, its discovery document, the HTTP client
+	// and the claims to validate
+	Verifier *JwtVerifier
+	// Endpoint overrides the `introspection_endpoint` of the discovery
+	// document
+	Endpoint string
+
+	ClientId     string
+	ClientSecret string
+	// PrivateKey signs the client assertions, with RS256 unless the key
+	// specifies its algorithm
+	PrivateKey jwk.Key
+
+	// MaxCacheTime bounds how long active results are cached, zero caches
+	// them until the token expires
+	MaxCacheTime time.Duration
+
+	results *cache.Cache
+}
+
+func (i *Introspector) New() (*Introspector, error) {
+	if i.Verifier == nil {
+		return nil, fmt.Errorf("the introspector needs a Verifier")
+	}
+	if i.ClientId == "" {
+		return nil, fmt.Errorf("the introspector needs a ClientId")
+	}
+	if i.results == nil {
+		i.results = cache.New(cache.NoExpiration, i.Verifier.Cleanup)
+	}
+	return i, nil
+}
+
+// Introspect verifies token with the introspection endpoint. It returns the
+// introspection response as the claims of the token. Cached results are
+// checked against the verifier's Revocation store like fresh ones.
+func (i *Introspector) Introspect(ctx context.Context, token string) (*Jwt, error) {
+	key := introspectionKey(token)
+	var myJwt *Jwt
+	if cached, found := i.results.Get(key); found {
+		if err, inactive := cached.(error); inactive {
+			return nil, err
+		}
+		myJwt = &Jwt{Claims: copyClaims(cached.(map[string]interface{}))}
+	} else {
+		var err error
+		if myJwt, err = i.introspectToken(ctx, key, token); err != nil {
+			return myJwt, err
+		}
+	}
+	if err := i.Verifier.checkRevocation(ctx, myJwt.Claims); err != nil {
+		return myJwt, err
+	}
+	return myJwt, nil
+}
+
+// introspectToken asks the introspection endpoint about token, bypassing
+// the cache, and caches the result under key when the token is active. An
+// inactive token is remembered for the verifier's ErrorTimeout, so that
+// invalid tokens sent again do not each cost a request.
+func (i *Introspector) introspectToken(ctx context.Context, key, token string) (*Jwt, error) {
+	endpoint, err := i.endpoint(ctx)
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonMetadataUnavailable, err)
+	}
+
+	claims, err := i.introspect(ctx, endpoint, token)
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonIntrospectionUnavailable, err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		err := errors.VerificationError(errors.ReasonInactive, fmt.Errorf("the token is not active"))
+		if i.Verifier.ErrorTimeout > 0 {
+			i.results.Set(key, err, i.Verifier.ErrorTimeout)
+		}
+		return nil, err
+	}
+	// an active refresh token must not be accepted as an access token
+	if tokenType, present := claims["token_type"]; present && !isAccessTokenType(tokenType) {
+		err := errors.VerificationError(errors.ReasonTokenType, fmt.Errorf("the token type %v is not an access token type", tokenType))
+		if i.Verifier.ErrorTimeout > 0 {
+			i.results.Set(key, err, i.Verifier.ErrorTimeout)
+		}
+		return nil, err
+	}
+
+	myJwt := Jwt{Claims: claims}
+	j := i.Verifier
+	if iss, present := claims["iss"]; present {
+		if err := j.validateIss(iss); err != nil {
+			return &myJwt, errors.VerificationError(errors.ReasonIssuer, fmt.Errorf("the `Issuer` was not able to be validated. %w", err))
+		}
+	}
+	if err := j.validateAudience(claims["aud"]); err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonAudience, fmt.Errorf("the `Audience` was not able to be validated. %w", err))
+	}
+	if err := j.validateClientId(claims["client_id"]); err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonClientId, fmt.Errorf("the `Client Id` was not able to be validated. %w", err))
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		ttl := time.Until(time.Unix(int64(exp), 0))
+		if i.MaxCacheTime > 0 && ttl > i.MaxCacheTime {
+			ttl = i.MaxCacheTime
+		}
+		// a copy, callers may change the claims they are returned
+		if ttl > 0 {
+			i.results.Set(key, copyClaims(claims), ttl)
+		}
+	}
+	return &myJwt, nil
+}
+
+func (i *Introspector) endpoint(ctx context.Context) (string, error) {
+	if i.Endpoint != "" {
+		return i.Endpoint, nil
+	}
+	metadata, err := i.Verifier.getMetaDataContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	endpoint, ok := metadata["introspection_endpoint"].(string)
+	if !ok || endpoint == "" {
+		return "", fmt.Errorf("the metadata of %q has no 'introspection_endpoint'", i.Verifier.Issuer)
+	}
+	return endpoint, nil
+}
+
+func (i *Introspector) introspect(ctx context.Context, endpoint, token string) (map[string]interface{}, error) {
+	// the default client has no timeout, and VerifyAccessToken no deadline
+	if i.Verifier.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.Verifier.FetchTimeout)
+		defer cancel()
+	}
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	if i.PrivateKey != nil {
+		assertion, err := i.clientAssertion(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		form.Set("client_id", i.ClientId)
+		form.Set("client_assertion_type", clientAssertionType)
+		form.Set("client_assertion", assertion)
+	} else if i.ClientSecret == "" {
+		form.Set("client_id", i.ClientId)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.PrivateKey == nil && i.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(i.ClientId), url.QueryEscape(i.ClientSecret))
+	}
+
+	resp, err := i.Verifier.Retry.Do(ctx, i.Verifier.Client, req)
+	if err != nil {
+		return nil, fmt.Errorf("request for introspection was not successful: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read introspection response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request for introspection %q was not HTTP 200 OK, it was: %d", endpoint, resp.StatusCode)
+	}
+
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("could not decode introspection response: %w", err)
+	}
+	return claims, nil
+}
+
+// clientAssertion returns a JWT authenticating the client to endpoint
+// (RFC 7523 section 2.2)
+func (i *Introspector) clientAssertion(endpoint string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	payload, err := json.Marshal(map[string]interface{}{
+		"iss": i.ClientId,
+		"sub": i.ClientId,
+		"aud": endpoint,
+		"jti": hex.EncodeToString(jti),
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	alg := jwa.RS256
+	if keyAlg, ok := i.PrivateKey.Algorithm().(jwa.SignatureAlgorithm); ok && keyAlg != "" {
+		alg = keyAlg
+	}
+	assertion, err := jws.Sign(payload, jws.WithKey(alg, i.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("could not sign the client assertion: %w", err)
+	}
+	return string(assertion), nil
+}
+
+// isAccessTokenType reports whether the `token_type` of an introspection
+// response is one of an access token
+func isAccessTokenType(tokenType interface{}) bool {
+	typ, _ := tokenType.(string)
+	switch strings.ToLower(typ) {
+	case "access_token", "bearer", "dpop":
+		return true
+	}
+	return false
+}
+
+func copyClaims(claims map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		copied[k] = v
+	}
+	return copied
+}
+
+// introspectionKey is the cache key of token, so that the cache does not
+// hold raw tokens
+func introspectionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
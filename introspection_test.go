@@ -0,0 +1,281 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+	"github.com/stretchr/testify/require"
+)
+
+const testIntrospectionEndpoint = testIssuer + "/v1/introspect"
+
+// registerIntrospection mocks the introspection endpoint of testIssuer, which
+// reports the tokens of active as active and records the requests it receives
+func registerIntrospection(t *testing.T, active map[string]map[string]interface{}, requests *[]*http.Request) {
+	t.Helper()
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		httpmock.NewStringResponder(200, `{"issuer":"`+testIssuer+`","jwks_uri":"`+testIssuer+`/v1/keys","introspection_endpoint":"`+testIntrospectionEndpoint+`"}`))
+	httpmock.RegisterResponder("POST", testIntrospectionEndpoint, func(req *http.Request) (*http.Response, error) {
+		require.NoError(t, req.ParseForm())
+		*requests = append(*requests, req)
+		claims, ok := active[req.PostForm.Get("token")]
+		if !ok {
+			return httpmock.NewStringResponse(200, `{"active":false}`), nil
+		}
+		response := map[string]interface{}{"active": true}
+		for k, v := range claims {
+			response[k] = v
+		}
+		return httpmock.NewJsonResponse(200, response)
+	})
+}
+
+func introspectedClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":       testIssuer,
+		"aud":       "api://default",
+		"client_id": "client",
+		"sub":       "user@example.com",
+		"scope":     "openid orders:read",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestIntrospectWithClientSecret(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{"opaque": introspectedClaims()}, &requests)
+
+	jvs := JwtVerifier{Issuer: testIssuer, ClaimsToValidate: map[string]string{"aud": "api://default", "cid": "client"}}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	introspector, err := (&Introspector{Verifier: jv, ClientId: "client", ClientSecret: "s3cr3t"}).New()
+	require.NoError(t, err)
+
+	token, err := introspector.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", token.Claims["sub"])
+	_, err = introspector.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	id, secret, ok := requests[0].BasicAuth()
+	require.True(t, ok)
+	require.Equal(t, "client", id)
+	require.Equal(t, "s3cr3t", secret)
+	require.Equal(t, "access_token", requests[0].PostForm.Get("token_type_hint"))
+
+	_, err = introspector.Introspect(context.Background(), "revoked")
+	require.Equal(t, errors.ReasonInactive, errors.ReasonOf(err))
+	// inactive results are cached briefly too
+	_, err = introspector.Introspect(context.Background(), "revoked")
+	require.Equal(t, errors.ReasonInactive, errors.ReasonOf(err))
+	require.Len(t, requests, 2)
+}
+
+func TestIntrospectValidatesClaims(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	claims := introspectedClaims()
+	claims["client_id"] = "other"
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{"opaque": claims}, &requests)
+
+	jvs := JwtVerifier{Issuer: testIssuer, ClaimsToValidate: map[string]string{"cid": "client"}}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	introspector, err := (&Introspector{Verifier: jv, ClientId: "client", ClientSecret: "s3cr3t"}).New()
+	require.NoError(t, err)
+
+	_, err = introspector.Introspect(context.Background(), "opaque")
+	require.Equal(t, errors.ReasonClientId, errors.ReasonOf(err))
+}
+
+func TestIntrospectWithPrivateKeyJwt(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{"opaque": introspectedClaims()}, &requests)
+
+	jvs := JwtVerifier{Issuer: testIssuer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	key := testissuer.NewKey(t, "client-key")
+	introspector, err := (&Introspector{Verifier: jv, ClientId: "client", PrivateKey: key.Private}).New()
+	require.NoError(t, err)
+
+	_, err = introspector.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+
+	require.Len(t, requests, 1)
+	form := requests[0].PostForm
+	_, _, hasBasic := requests[0].BasicAuth()
+	require.False(t, hasBasic)
+	require.Equal(t, "client", form.Get("client_id"))
+	require.Equal(t, clientAssertionType, form.Get("client_assertion_type"))
+	payload, err := jws.Verify([]byte(form.Get("client_assertion")), jws.WithKey(jwa.RS256, key.Public))
+	require.NoError(t, err)
+	var assertion map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &assertion))
+	require.Equal(t, "client", assertion["iss"])
+	require.Equal(t, "client", assertion["sub"])
+	require.Equal(t, testIntrospectionEndpoint, assertion["aud"])
+	require.NotEmpty(t, assertion["jti"])
+}
+
+func TestIntrospectionUnavailable(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var requests []*http.Request
+	registerIntrospection(t, nil, &requests)
+	httpmock.RegisterResponder("POST", testIntrospectionEndpoint, httpmock.NewStringResponder(401, `{"error":"invalid_client"}`))
+
+	jvs := JwtVerifier{Issuer: testIssuer, Retry: &utils.RetryPolicy{MaxAttempts: 1}}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	introspector, err := (&Introspector{Verifier: jv, ClientId: "client", ClientSecret: "wrong"}).New()
+	require.NoError(t, err)
+
+	_, err = introspector.Introspect(context.Background(), "opaque")
+	require.Equal(t, errors.ReasonIntrospectionUnavailable, errors.ReasonOf(err))
+	require.True(t, errors.ReasonOf(err).Unavailable())
+}
+
+func TestFetchTimeoutEndsHangingIntrospection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var requests []*http.Request
+	registerIntrospection(t, nil, &requests)
+	httpmock.RegisterResponder("POST", testIntrospectionEndpoint, func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	jvs := JwtVerifier{
+		Issuer:       testIssuer,
+		Retry:        &utils.RetryPolicy{MaxAttempts: 3},
+		FetchTimeout: 50 * time.Millisecond,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	introspector, err := (&Introspector{Verifier: jv, ClientId: "client", ClientSecret: "s3cr3t"}).New()
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = introspector.Introspect(context.Background(), "opaque")
+	require.Equal(t, errors.ReasonIntrospectionUnavailable, errors.ReasonOf(err))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestHybridVerificationFallsBackToIntrospection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+	var requests []*http.Request
+	unpublished := testissuer.NewKey(t, "kid-org").Sign(t, validClaims())
+	active := map[string]map[string]interface{}{"opaque": introspectedClaims(), unpublished: introspectedClaims()}
+	registerIntrospection(t, active, &requests)
+
+	jvs := JwtVerifier{
+		Issuer:        testIssuer,
+		Introspection: &Introspector{ClientId: "client", ClientSecret: "s3cr3t"},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.NoError(t, err)
+	require.Empty(t, requests)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = jv.VerifyAccessToken(key.Sign(t, expired))
+	require.Equal(t, errors.ReasonExpired, errors.ReasonOf(err))
+	require.Empty(t, requests)
+
+	token, err := jv.VerifyAccessToken("opaque")
+	require.NoError(t, err)
+	require.Equal(t, "openid orders:read", token.Claims["scope"])
+
+	_, err = jv.VerifyAccessToken(unpublished)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+
+	_, err = jv.VerifyAccessToken("unknown")
+	require.Equal(t, errors.ReasonInactive, errors.ReasonOf(err))
+	require.Equal(t, url.Values{"token": {"unknown"}, "token_type_hint": {"access_token"}}, requests[2].PostForm)
+}
+
+func TestIntrospectRejectsOtherTokenTypes(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	refresh := introspectedClaims()
+	refresh["token_type"] = "refresh_token"
+	dpopBound := introspectedClaims()
+	dpopBound["token_type"] = "DPoP"
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{"refresh": refresh, "dpop": dpopBound}, &requests)
+
+	jvs := JwtVerifier{
+		Issuer:        testIssuer,
+		Introspection: &Introspector{ClientId: "client", ClientSecret: "s3cr3t"},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken("refresh")
+	require.Equal(t, errors.ReasonTokenType, errors.ReasonOf(err))
+	_, err = jv.VerifyAccessToken("dpop")
+	require.NoError(t, err)
+}
+
+func TestIntrospectReturnsCopiesOfCachedClaims(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{"opaque": introspectedClaims()}, &requests)
+
+	jvs := JwtVerifier{Issuer: testIssuer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	introspector, err := (&Introspector{Verifier: jv, ClientId: "client", ClientSecret: "s3cr3t"}).New()
+	require.NoError(t, err)
+
+	token, err := introspector.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+	token.Claims["sub"] = "admin@example.com"
+
+	token, err = introspector.Introspect(context.Background(), "opaque")
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", token.Claims["sub"])
+	require.Len(t, requests, 1)
+}
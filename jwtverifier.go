@@ -17,24 +17,40 @@
 package jwtverifier
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/okta/okta-jwt-verifier-golang/v2/adaptors"
 	"github.com/okta/okta-jwt-verifier-golang/v2/adaptors/lestrratGoJwx"
 	"github.com/okta/okta-jwt-verifier-golang/v2/discovery"
 	"github.com/okta/okta-jwt-verifier-golang/v2/discovery/oidc"
+	"github.com/okta/okta-jwt-verifier-golang/v2/dpop"
 	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/events"
+	"github.com/okta/okta-jwt-verifier-golang/v2/extractors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/logging"
+	"github.com/okta/okta-jwt-verifier-golang/v2/metrics"
+	"github.com/okta/okta-jwt-verifier-golang/v2/mtls"
+	"github.com/okta/okta-jwt-verifier-golang/v2/replay"
+	"github.com/okta/okta-jwt-verifier-golang/v2/revocation"
+	"github.com/okta/okta-jwt-verifier-golang/v2/tracing"
 	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+	"github.com/patrickmn/go-cache"
 )
 
 var (
 	regx = regexp.MustCompile(`[a-zA-Z0-9-_]+\.[a-zA-Z0-9-_]+\.?([a-zA-Z0-9-_]+)[/a-zA-Z0-9-_]+?$`)
+
+	// allowedAlgorithms are the token signing algorithms the verifier accepts
+	allowedAlgorithms = []string{"RS256"}
 )
 
 type JwtVerifier struct {
@@ -42,32 +58,110 @@ type JwtVerifier struct {
 
 	ClaimsToValidate map[string]string
 
+	// EnforceJwksUriSameOrigin rejects discovery documents whose `jwks_uri`
+	// is not served from the same scheme and host as the Issuer
+	EnforceJwksUriSameOrigin bool
+
 	Discovery discovery.Discovery
 
 	Adaptor adaptors.Adaptor
 
 	Client *http.Client
 
+	// Retry is applied to the discovery and key set requests, it defaults to
+	// utils.DefaultRetryPolicy()
+	Retry *utils.RetryPolicy
+
 	// Cache allows customization of the cache used to store resources
-	Cache func(func(string) (interface{}, error), time.Duration, time.Duration) (utils.Cacher, error)
+	Cache utils.CacheFactory
+
+	// Observer receives verification, cache, fetch and key rotation events,
+	// see metrics.NewPrometheus for an exporter
+	Observer metrics.Observer
+
+	// Tracer starts spans around verifications, cache lookups and fetches,
+	// see tracing/opentelemetry for an OpenTelemetry adapter
+	Tracer tracing.Tracer
+
+	// Logger receives structured records of fetches, key rotations and
+	// verification failures, see logging.NewSlog for a log/slog adapter
+	Logger logging.Logger
+
+	// Events are called on key rotations, metadata changes, repeated fetch
+	// failures, unknown key ids and rejected tokens
+	Events events.Handlers
+
+	// Introspection, when set, verifies the access tokens that cannot be
+	// verified locally, such as opaque tokens or tokens signed with keys the
+	// issuer does not publish
+	Introspection *Introspector
+
+	// Revocation rejects tokens whose jti, sub or sid was revoked after they
+	// were issued
+	Revocation revocation.Store
+
+	// Replay, when set, accepts each id token once: a token is remembered
+	// by its jti, or its hash, until it expires
+	Replay replay.Store
+
+	// ConfirmInterval, when set along with Introspection, confirms with the
+	// introspection endpoint that locally verified access tokens issued more
+	// than ConfirmInterval ago are still active, at most once per interval
+	ConfirmInterval time.Duration
+
+	// Extractor finds the access token of a request for VerifyRequest, it
+	// defaults to extractors.AuthorizationHeader()
+	Extractor extractors.Extractor
 
 	metadataCache utils.Cacher
+	fetcher       *utils.Fetcher
+	// confirmations remembers the access tokens recently confirmed by
+	// introspection
+	confirmations *cache.Cache
+	// logouts remembers the logout tokens, it is the Replay store when set
+	logouts       replay.Store
+	fetchFailures events.FailureCounter
+	// metadataUrl remembers which discovery location last succeeded
+	metadataUrl atomic.Value
+	// metadataStatus holds the metadataStatus of the last successful fetch
+	metadataStatus atomic.Value
 
 	leeway  int64
 	Timeout time.Duration
 	Cleanup time.Duration
+	// MinTimeout and MaxTimeout bound how long the discovery document and
+	// key set are cached when the issuer sends `Cache-Control` or `Expires`
+	// headers. They default to one minute and Timeout.
+	MinTimeout time.Duration
+	MaxTimeout time.Duration
+	// FetchTimeout bounds each request for the discovery document or key
+	// set, retries included. It defaults to 30 seconds, or Timeout when that
+	// is shorter.
+	FetchTimeout time.Duration
+	// ErrorTimeout is how long the default cache remembers a failed fetch
+	// before trying again, it defaults to 10 seconds. It has no effect on a
+	// custom Cache.
+	ErrorTimeout time.Duration
 }
 
 type Jwt struct {
 	Claims map[string]interface{}
 }
 
-func (j *JwtVerifier) fetchMetaData(url string) (interface{}, error) {
-	resp, err := j.Client.Get(url)
+func (j *JwtVerifier) fetchMetaData(url string) (value interface{}, err error) {
+	// the fetch is shared by every caller waiting on url, so it is traced on
+	// its own rather than under one of them
+	ctx, span := j.Tracer.Start(context.Background(), tracing.SpanFetch,
+		tracing.String(tracing.AttributeIssuer, j.Issuer),
+		tracing.String(tracing.AttributeResource, metrics.ResourceMetadata),
+		tracing.String(tracing.AttributeUrl, url))
+	defer func() { span.End(err) }()
+
+	resp, err := j.fetcher.Fetch(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("request for metadata was not successful: %w", err)
 	}
-	defer resp.Body.Close()
+	span.SetAttributes(tracing.Int(tracing.AttributeStatusCode, resp.StatusCode))
 
 	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
 	if !ok {
@@ -75,10 +169,104 @@ func (j *JwtVerifier) fetchMetaData(url string) (interface{}, error) {
 	}
 
 	metadata := make(map[string]interface{})
-	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+	if err := json.Unmarshal(resp.Body, &metadata); err != nil {
 		return nil, err
 	}
-	return metadata, nil
+	if err := j.validateMetaData(metadata); err != nil {
+		j.Logger.Log(ctx, logging.LevelError, "discovery document is not valid for the issuer",
+			logging.F(logging.FieldIssuer, j.Issuer), logging.F(logging.FieldUrl, url), logging.F(logging.FieldError, err.Error()))
+		return nil, fmt.Errorf("metadata from %q is not valid: %w", url, err)
+	}
+	level, msg := logging.LevelInfo, "fetched discovery document"
+	previous, refreshed := j.metadataStatus.Load().(metadataStatus)
+	if refreshed {
+		level, msg = logging.LevelDebug, "refreshed discovery document"
+	}
+	j.Logger.Log(ctx, level, msg, logging.F(logging.FieldIssuer, j.Issuer), logging.F(logging.FieldUrl, url))
+	j.metadataStatus.Store(metadataStatus{fetchedAt: time.Now(), jwksUri: metadata["jwks_uri"].(string), metadata: metadata})
+
+	if refreshed && previous.metadata != nil && j.Events.MetadataChanged != nil {
+		if fields := events.ChangedFields(previous.metadata, metadata); len(fields) > 0 {
+			j.Events.MetadataChanged(events.MetadataChange{
+				Issuer:   j.Issuer,
+				Url:      url,
+				Fields:   fields,
+				Previous: previous.metadata,
+				Current:  metadata,
+			})
+		}
+	}
+	return utils.ExpiringValue{Value: metadata, TTL: resp.TTL}, nil
+}
+
+// validateMetaData checks a discovery document before it is cached. The
+// `issuer` must exactly match the configured Issuer (OIDC Discovery 1.0
+// section 4.3) so that a misrouted request never hands us another tenant's
+// keys.
+func (j *JwtVerifier) validateMetaData(metadata map[string]interface{}) error {
+	issuer, ok := metadata["issuer"].(string)
+	if !ok {
+		return fmt.Errorf("missing 'issuer'")
+	}
+	if issuer != j.Issuer {
+		return fmt.Errorf("issuer: %s does not match %s", issuer, j.Issuer)
+	}
+
+	jwksURI, ok := metadata["jwks_uri"].(string)
+	if !ok {
+		return fmt.Errorf("missing 'jwks_uri'")
+	}
+	if j.EnforceJwksUriSameOrigin {
+		if err := sameOrigin(j.Issuer, jwksURI); err != nil {
+			return err
+		}
+	}
+
+	// The list of signing algorithms is only mandatory for OIDC providers,
+	// validate it when it is advertised.
+	if algs, exists := metadata["id_token_signing_alg_values_supported"]; exists {
+		supported, ok := algs.([]interface{})
+		if !ok {
+			return fmt.Errorf("unknown type for 'id_token_signing_alg_values_supported'")
+		}
+		if !containsAllowedAlgorithm(supported) {
+			return fmt.Errorf("id_token_signing_alg_values_supported: %v does not contain any of %v", supported, allowedAlgorithms)
+		}
+	}
+	return nil
+}
+
+func sameOrigin(issuer, jwksURI string) error {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("could not parse issuer: %w", err)
+	}
+	jwksURL, err := url.Parse(jwksURI)
+	if err != nil {
+		return fmt.Errorf("could not parse jwks_uri: %w", err)
+	}
+	if !strings.EqualFold(issuerURL.Scheme, jwksURL.Scheme) || !strings.EqualFold(issuerURL.Host, jwksURL.Host) {
+		return fmt.Errorf("jwks_uri: %s is not on the same origin as %s", jwksURI, issuer)
+	}
+	return nil
+}
+
+func containsAllowedAlgorithm(supported []interface{}) bool {
+	for _, s := range supported {
+		if isAllowedAlgorithm(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedAlgorithm(alg interface{}) bool {
+	for _, allowed := range allowedAlgorithms {
+		if alg == allowed {
+			return true
+		}
+	}
+	return false
 }
 
 func (j *JwtVerifier) New() (*JwtVerifier, error) {
@@ -100,13 +288,70 @@ func (j *JwtVerifier) New() (*JwtVerifier, error) {
 		j.Client = http.DefaultClient
 	}
 
+	if j.MaxTimeout == 0 {
+		j.MaxTimeout = j.Timeout
+	}
+
+	if j.MinTimeout == 0 {
+		j.MinTimeout = time.Minute
+	}
+
+	if j.MinTimeout > j.MaxTimeout {
+		j.MinTimeout = j.MaxTimeout
+	}
+
+	if j.FetchTimeout == 0 {
+		j.FetchTimeout = 30 * time.Second
+		if j.Timeout < j.FetchTimeout {
+			j.FetchTimeout = j.Timeout
+		}
+	}
+
+	if j.ErrorTimeout == 0 {
+		j.ErrorTimeout = 10 * time.Second
+	}
+
 	if j.Cache == nil {
-		j.Cache = utils.NewDefaultCache
+		j.Cache = utils.NewDefaultCacheWithErrorTimeout(j.ErrorTimeout)
+	}
+
+	if j.Retry == nil {
+		j.Retry = utils.DefaultRetryPolicy()
+	}
+
+	if j.Observer == nil {
+		j.Observer = metrics.Nop{}
+	}
+
+	if j.Tracer == nil {
+		j.Tracer = tracing.Nop{}
+	}
+
+	if j.Extractor == nil {
+		j.Extractor = extractors.AuthorizationHeader()
+	}
+
+	if j.Logger == nil {
+		j.Logger = logging.Nop{}
 	}
 
 	// Default to LestrratGoJwx Adaptor if none is defined
 	if j.Adaptor == nil {
-		adaptor := &lestrratGoJwx.LestrratGoJwx{Cache: j.Cache, Timeout: j.Timeout, Cleanup: j.Cleanup, Client: j.Client}
+		adaptor := &lestrratGoJwx.LestrratGoJwx{
+			Issuer:       j.Issuer,
+			Cache:        j.Cache,
+			Timeout:      j.Timeout,
+			Cleanup:      j.Cleanup,
+			MinTimeout:   j.MinTimeout,
+			MaxTimeout:   j.MaxTimeout,
+			Client:       j.Client,
+			Retry:        j.Retry,
+			FetchTimeout: j.FetchTimeout,
+			Observer:     j.Observer,
+			Tracer:       j.Tracer,
+			Logger:       j.Logger,
+			Events:       j.Events,
+		}
 		adp, err := adaptor.New()
 		if err != nil {
 			return nil, err
@@ -116,12 +361,50 @@ func (j *JwtVerifier) New() (*JwtVerifier, error) {
 
 	// Default to PT2M Leeway
 	j.leeway = 120
+	j.fetcher = &utils.Fetcher{
+		Client:  j.Client,
+		Retry:   j.Retry,
+		MinTTL:  j.MinTimeout,
+		MaxTTL:  j.MaxTimeout,
+		Timeout: j.FetchTimeout,
+		OnFetch: func(url string, statusCode int, d time.Duration, err error) {
+			j.Observer.FetchCompleted(metrics.FetchEvent{
+				Issuer:     j.Issuer,
+				Resource:   metrics.ResourceMetadata,
+				Url:        url,
+				StatusCode: statusCode,
+				Duration:   d,
+				Err:        err,
+			})
+			logging.LogFetch(j.Logger, j.Issuer, "metadata", url, statusCode, d, err)
+			j.fetchFailures.Record(j.Events, j.Issuer, url, statusCode, err)
+		},
+	}
 	var err error
 	metadataCache, err := j.Cache(j.fetchMetaData, j.Timeout, j.Cleanup)
 	if err != nil {
 		return nil, err
 	}
+	utils.SetCodec(metadataCache, metadataCodec{verifier: j})
 	j.metadataCache = metadataCache
+
+	if j.Introspection != nil {
+		if j.Introspection.Verifier == nil {
+			j.Introspection.Verifier = j
+		}
+		if _, err := j.Introspection.New(); err != nil {
+			return nil, err
+		}
+	}
+
+	if j.ConfirmInterval > 0 && j.Introspection != nil {
+		j.confirmations = cache.New(j.ConfirmInterval, j.Cleanup)
+	}
+
+	j.logouts = j.Replay
+	if j.logouts == nil {
+		j.logouts = &replay.Memory{}
+	}
 	return j, nil
 }
 
@@ -139,12 +422,39 @@ func (j *JwtVerifier) SetCleanUp(duration time.Duration) {
 }
 
 func (j *JwtVerifier) VerifyAccessToken(jwt string) (*Jwt, error) {
+	return j.VerifyAccessTokenContext(context.Background(), jwt)
+}
+
+// VerifyAccessTokenContext verifies an access token like VerifyAccessToken.
+// Fetching the metadata and key set stops waiting once ctx is done.
+func (j *JwtVerifier) VerifyAccessTokenContext(ctx context.Context, jwt string) (*Jwt, error) {
+	start := time.Now()
+	ctx, span := j.startVerification(ctx, tracing.SpanVerifyAccessToken, "access_token", jwt)
+	token, err := j.verifyAccessToken(ctx, jwt)
+	if err != nil && j.shouldIntrospect(jwt, err) {
+		token, err = j.Introspection.Introspect(ctx, jwt)
+	}
+	j.endVerification(ctx, span, "access_token", jwt, token, start, err)
+	return token, err
+}
+
+// shouldIntrospect reports whether a token that failed local verification
+// may still be valid according to the introspection endpoint
+func (j *JwtVerifier) shouldIntrospect(jwt string, err error) bool {
+	if j.Introspection == nil || jwt == "" {
+		return false
+	}
+	reason := errors.ReasonOf(err)
+	return reason == errors.ReasonMalformed || reason == errors.ReasonSignature
+}
+
+func (j *JwtVerifier) verifyAccessToken(ctx context.Context, jwt string) (*Jwt, error) {
 	validJwt, err := j.isValidJwt(jwt)
 	if !validJwt {
-		return nil, fmt.Errorf("token is not valid: %w", err)
+		return nil, errors.VerificationError(errors.ReasonMalformed, fmt.Errorf("token is not valid: %w", err))
 	}
 
-	resp, err := j.decodeJwt(jwt)
+	resp, err := j.decodeJwt(ctx, jwt)
 	if err != nil {
 		return nil, err
 	}
@@ -157,56 +467,188 @@ func (j *JwtVerifier) VerifyAccessToken(jwt string) (*Jwt, error) {
 
 	err = j.validateIss(token["iss"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issuer` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonIssuer, fmt.Errorf("the `Issuer` was not able to be validated. %w", err))
 	}
 
 	err = j.validateAudience(token["aud"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Audience` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonAudience, fmt.Errorf("the `Audience` was not able to be validated. %w", err))
 	}
 
 	err = j.validateClientId(token["cid"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Client Id` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonClientId, fmt.Errorf("the `Client Id` was not able to be validated. %w", err))
 	}
 
 	err = j.validateExp(token["exp"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Expiration` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonExpired, fmt.Errorf("the `Expiration` was not able to be validated. %w", err))
 	}
 
 	err = j.validateIat(token["iat"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issued At` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonIssuedAt, fmt.Errorf("the `Issued At` was not able to be validated. %w", err))
+	}
+
+	err = j.checkRevocation(ctx, token)
+	if err != nil {
+		return &myJwt, err
+	}
+
+	err = j.confirmActive(ctx, jwt, token)
+	if err != nil {
+		return &myJwt, err
 	}
 
 	return &myJwt, nil
 }
 
-func (j *JwtVerifier) decodeJwt(jwt string) (interface{}, error) {
-	metaData, err := j.getMetaData()
+func (j *JwtVerifier) startVerification(ctx context.Context, name, tokenType, jwt string) (context.Context, tracing.Span) {
+	attributes := []tracing.Attribute{
+		tracing.String(tracing.AttributeIssuer, j.Issuer),
+		tracing.String(tracing.AttributeTokenType, tokenType),
+	}
+	header := tokenHeader(jwt)
+	if kid, ok := header["kid"].(string); ok {
+		attributes = append(attributes, tracing.String(tracing.AttributeKeyId, kid))
+	}
+	if alg, ok := header["alg"].(string); ok {
+		attributes = append(attributes, tracing.String(tracing.AttributeAlgorithm, alg))
+	}
+	return j.Tracer.Start(ctx, name, attributes...)
+}
+
+func (j *JwtVerifier) endVerification(ctx context.Context, span tracing.Span, tokenType, jwt string, token *Jwt, start time.Time, err error) {
+	reason := errors.ReasonOf(err)
+	outcome := "valid"
 	if err != nil {
-		return nil, err
+		outcome = string(reason)
+	}
+	span.SetAttributes(tracing.String(tracing.AttributeOutcome, outcome))
+	span.End(err)
+
+	j.Observer.VerificationCompleted(metrics.VerificationEvent{
+		Issuer:    j.Issuer,
+		TokenType: tokenType,
+		Reason:    reason,
+		Duration:  time.Since(start),
+	})
+
+	fields := []logging.Field{
+		logging.F(logging.FieldIssuer, j.Issuer),
+		logging.F(logging.FieldTokenType, tokenType),
+		logging.F(logging.FieldToken, logging.Fingerprint(jwt)),
+	}
+	kid, _ := tokenHeader(jwt)["kid"].(string)
+	if kid != "" {
+		fields = append(fields, logging.F(logging.FieldKeyId, kid))
+	}
+	if token != nil {
+		if iss, ok := token.Claims["iss"].(string); ok {
+			fields = append(fields, logging.F(logging.FieldTokenIssuer, iss))
+		}
+		if sub, ok := token.Claims["sub"].(string); ok {
+			fields = append(fields, logging.F(logging.FieldSubject, logging.HashSubject(sub)))
+		}
+	}
+	if err == nil {
+		j.Logger.Log(ctx, logging.LevelDebug, "token verified", fields...)
+		return
+	}
+	// failing to reach the issuer affects every token, a rejected token only
+	// its bearer
+	level := logging.LevelInfo
+	if reason.Unavailable() {
+		level = logging.LevelWarn
+	}
+	fields = append(fields, logging.F(logging.FieldReason, string(reason)), logging.F(logging.FieldError, err.Error()))
+	j.Logger.Log(ctx, level, "token verification failed", fields...)
+
+	if j.Events.VerificationFailed != nil {
+		j.Events.VerificationFailed(events.VerificationFailure{
+			Issuer:    j.Issuer,
+			TokenType: tokenType,
+			KeyId:     kid,
+			Reason:    reason,
+			Err:       err,
+		})
+	}
+}
+
+func (j *JwtVerifier) decodeJwt(ctx context.Context, jwt string) (interface{}, error) {
+	metaData, err := j.getMetaDataContext(ctx)
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonMetadataUnavailable, err)
 	}
 	jwksURI, ok := metaData["jwks_uri"].(string)
 	if !ok {
-		return nil, fmt.Errorf("failed to decode JWT: missing 'jwks_uri' from metadata")
+		return nil, errors.VerificationError(errors.ReasonMetadataUnavailable,
+			fmt.Errorf("failed to decode JWT: missing 'jwks_uri' from metadata"))
 	}
-	resp, err := j.Adaptor.Decode(jwt, jwksURI)
+	resp, err := adaptors.DecodeContext(ctx, j.Adaptor, jwt, jwksURI)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode token: %w", err)
+		// adaptors tell key set failures apart from invalid signatures
+		reason := errors.ReasonOf(err)
+		if reason == "" {
+			reason = errors.ReasonSignature
+		}
+		return nil, errors.VerificationError(reason, fmt.Errorf("could not decode token: %w", err))
 	}
 
 	return resp, nil
 }
 
+// VerifyRequest verifies the access token found in r by the Extractor, with
+// the context of r. Tokens bound to a DPoP key are rejected, since r is not
+// checked for a proof, see middleware.Bearer. Tokens bound to a client
+// certificate must match the certificate of r.TLS.
+func (j *JwtVerifier) VerifyRequest(r *http.Request) (*Jwt, error) {
+	token, err := j.Extractor.Extract(r)
+	if err != nil {
+		return nil, errors.VerificationError(errors.ReasonMalformed, fmt.Errorf("could not extract the token: %w", err))
+	}
+	if token == "" {
+		return nil, errors.VerificationError(errors.ReasonMissing, fmt.Errorf("the request does not carry a token"))
+	}
+	myJwt, err := j.VerifyAccessTokenContext(r.Context(), token)
+	if err != nil {
+		return myJwt, err
+	}
+	// a DPoP-bound token must not be accepted as a bearer token (RFC 9449
+	// section 7.1)
+	if dpop.Bound(myJwt.Claims) {
+		return myJwt, errors.VerificationError(errors.ReasonBinding,
+			fmt.Errorf("the access token is bound to a DPoP key and needs a proof"))
+	}
+	if mtls.Bound(myJwt.Claims) {
+		if err := mtls.CheckConnection(myJwt.Claims, r.TLS); err != nil {
+			return myJwt, err
+		}
+	}
+	return myJwt, nil
+}
+
 func (j *JwtVerifier) VerifyIdToken(jwt string) (*Jwt, error) {
+	return j.VerifyIdTokenContext(context.Background(), jwt)
+}
+
+// VerifyIdTokenContext verifies an id token like VerifyIdToken. Fetching the
+// metadata and key set stops waiting once ctx is done.
+func (j *JwtVerifier) VerifyIdTokenContext(ctx context.Context, jwt string) (*Jwt, error) {
+	start := time.Now()
+	ctx, span := j.startVerification(ctx, tracing.SpanVerifyIdToken, "id_token", jwt)
+	token, err := j.verifyIdToken(ctx, jwt)
+	j.endVerification(ctx, span, "id_token", jwt, token, start, err)
+	return token, err
+}
+
+func (j *JwtVerifier) verifyIdToken(ctx context.Context, jwt string) (*Jwt, error) {
 	validJwt, err := j.isValidJwt(jwt)
 	if !validJwt {
-		return nil, fmt.Errorf("token is not valid: %w", err)
+		return nil, errors.VerificationError(errors.ReasonMalformed, fmt.Errorf("token is not valid: %w", err))
 	}
 
-	resp, err := j.decodeJwt(jwt)
+	resp, err := j.decodeJwt(ctx, jwt)
 	if err != nil {
 		return nil, err
 	}
@@ -219,32 +661,104 @@ func (j *JwtVerifier) VerifyIdToken(jwt string) (*Jwt, error) {
 
 	err = j.validateIss(token["iss"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issuer` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonIssuer, fmt.Errorf("the `Issuer` was not able to be validated. %w", err))
 	}
 
 	err = j.validateAudience(token["aud"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Audience` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonAudience, fmt.Errorf("the `Audience` was not able to be validated. %w", err))
 	}
 
 	err = j.validateExp(token["exp"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Expiration` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonExpired, fmt.Errorf("the `Expiration` was not able to be validated. %w", err))
 	}
 
 	err = j.validateIat(token["iat"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Issued At` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonIssuedAt, fmt.Errorf("the `Issued At` was not able to be validated. %w", err))
 	}
 
 	err = j.validateNonce(token["nonce"])
 	if err != nil {
-		return &myJwt, fmt.Errorf("the `Nonce` was not able to be validated. %w", err)
+		return &myJwt, errors.VerificationError(errors.ReasonNonce, fmt.Errorf("the `Nonce` was not able to be validated. %w", err))
+	}
+
+	err = j.checkRevocation(ctx, token)
+	if err != nil {
+		return &myJwt, err
+	}
+
+	err = j.checkReplay(ctx, j.Replay, jwt, token)
+	if err != nil {
+		return &myJwt, err
 	}
 
 	return &myJwt, nil
 }
 
+// checkReplay rejects the token when store saw it before. It runs last, so
+// that only tokens valid otherwise are remembered.
+func (j *JwtVerifier) checkReplay(ctx context.Context, store replay.Store, jwt string, claims map[string]interface{}) error {
+	if store == nil {
+		return nil
+	}
+	err := replay.Check(ctx, store, jwt, claims, time.Duration(j.leeway)*time.Second)
+	if err == replay.ErrReplayed {
+		return errors.VerificationError(errors.ReasonReplayed, err)
+	}
+	if err != nil {
+		return errors.VerificationError(errors.ReasonReplayUnavailable,
+			fmt.Errorf("the replay of the token could not be checked: %w", err))
+	}
+	return nil
+}
+
+// checkRevocation rejects the token when the Revocation store revoked one of
+// its claims at or after the token was issued
+func (j *JwtVerifier) checkRevocation(ctx context.Context, claims map[string]interface{}) error {
+	if j.Revocation == nil {
+		return nil
+	}
+	iat, _ := claims["iat"].(float64)
+	for _, kind := range revocation.Kinds {
+		value, ok := claims[string(kind)].(string)
+		if !ok || value == "" {
+			continue
+		}
+		revokedAt, revoked, err := j.Revocation.RevokedAt(ctx, kind, value)
+		if err != nil {
+			return errors.VerificationError(errors.ReasonRevocationUnavailable,
+				fmt.Errorf("the revocation of the token could not be checked: %w", err))
+		}
+		if revoked && float64(revokedAt.Unix()) >= iat {
+			return errors.VerificationError(errors.ReasonRevoked, fmt.Errorf("the token %s was revoked", kind))
+		}
+	}
+	return nil
+}
+
+// confirmActive asks the introspection endpoint whether an access token
+// issued more than ConfirmInterval ago is still active
+func (j *JwtVerifier) confirmActive(ctx context.Context, jwt string, claims map[string]interface{}) error {
+	if j.confirmations == nil {
+		return nil
+	}
+	iat, _ := claims["iat"].(float64)
+	if time.Since(time.Unix(int64(iat), 0)) < j.ConfirmInterval {
+		return nil
+	}
+	key := introspectionKey(jwt)
+	if _, confirmed := j.confirmations.Get(key); confirmed {
+		return nil
+	}
+	if _, err := j.Introspection.introspectToken(ctx, key, jwt); err != nil {
+		return err
+	}
+	j.confirmations.SetDefault(key, true)
+	return nil
+}
+
 func (j *JwtVerifier) GetDiscovery() discovery.Discovery {
 	return j.Discovery
 }
@@ -352,18 +866,124 @@ func (j *JwtVerifier) validateIss(issuer interface{}) error {
 }
 
 func (j *JwtVerifier) getMetaData() (map[string]interface{}, error) {
-	metaDataUrl := j.Issuer + j.Discovery.GetWellKnownUrl()
+	return j.getMetaDataContext(context.Background())
+}
+
+func (j *JwtVerifier) getMetaDataContext(ctx context.Context) (map[string]interface{}, error) {
+	urls := discovery.MetadataUrls(j.Discovery, j.Issuer)
+	// Start with the location that answered last time so that a fallback
+	// chain does not retry the strategies that are known to fail.
+	if preferred, ok := j.metadataUrl.Load().(string); ok && preferred != "" {
+		urls = append([]string{preferred}, removeString(urls, preferred)...)
+	}
+
+	var failures []string
+	var err error
+	for _, metaDataUrl := range urls {
+		var metadata map[string]interface{}
+		metadata, err = j.getMetaDataFrom(ctx, metaDataUrl)
+		if err == nil {
+			j.metadataUrl.Store(metaDataUrl)
+			return metadata, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		failures = append(failures, err.Error())
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("discovery did not provide a metadata url for %q", j.Issuer)
+	}
+	if len(urls) == 1 {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no metadata could be found for %q, tried: %s: %w",
+		j.Issuer, strings.Join(failures[:len(failures)-1], "; "), err)
+}
 
-	value, err := j.metadataCache.Get(metaDataUrl)
+func (j *JwtVerifier) getMetaDataFrom(ctx context.Context, metaDataUrl string) (metadata map[string]interface{}, err error) {
+	ctx, span := j.Tracer.Start(ctx, tracing.SpanGetMetadata,
+		tracing.String(tracing.AttributeIssuer, j.Issuer),
+		tracing.String(tracing.AttributeUrl, metaDataUrl))
+	defer func() { span.End(err) }()
+
+	if result, ok := metrics.CacheResultOf(j.metadataCache, metaDataUrl, j.Timeout); ok {
+		span.SetAttributes(tracing.String(tracing.AttributeCacheResult, string(result)))
+		j.Observer.CacheAccessed(metrics.CacheEvent{
+			Issuer:   j.Issuer,
+			Resource: metrics.ResourceMetadata,
+			Key:      metaDataUrl,
+			Result:   result,
+		})
+	}
+	value, err := utils.GetContext(ctx, j.metadataCache, metaDataUrl)
 	if err != nil {
 		return nil, err
 	}
 
-	metadata, ok := value.(map[string]interface{})
-	if !ok {
+	switch v := utils.UnwrapValue(value).(type) {
+	case map[string]interface{}:
+		// values shared by another process were not fetched by this one
+		if _, fetched := j.metadataStatus.Load().(metadataStatus); !fetched {
+			jwksUri, _ := v["jwks_uri"].(string)
+			j.metadataStatus.Store(metadataStatus{fetchedAt: time.Now(), jwksUri: jwksUri, metadata: v})
+		}
+		return v, nil
+	case json.RawMessage:
+		// persisted by a cache outside of the process, validate it again
+		metadata := make(map[string]interface{})
+		if err := json.Unmarshal(v, &metadata); err != nil {
+			return nil, fmt.Errorf("unable to decode cached metadata: %w", err)
+		}
+		if err := j.validateMetaData(metadata); err != nil {
+			return nil, fmt.Errorf("cached metadata from %q is not valid: %w", metaDataUrl, err)
+		}
+		return metadata, nil
+	default:
 		return nil, fmt.Errorf("unable to cast %v to metadata", value)
 	}
-	return metadata, nil
+}
+
+// InvalidateMetadata drops the cached discovery document of the Issuer so
+// that it is fetched again by the next verification. It requires the Cache
+// to implement utils.ManagedCacher.
+func (j *JwtVerifier) InvalidateMetadata() error {
+	cache, ok := j.metadataCache.(utils.ManagedCacher)
+	if !ok {
+		return fmt.Errorf("the metadata cache %T does not support invalidation", j.metadataCache)
+	}
+	for _, metaDataUrl := range discovery.MetadataUrls(j.Discovery, j.Issuer) {
+		cache.Invalidate(metaDataUrl)
+	}
+	j.metadataUrl.Store("")
+	return nil
+}
+
+// InvalidateKeys drops the cached key set of the Issuer so that it is
+// fetched again by the next verification, for instance after learning that
+// the keys were rotated. It requires the Adaptor to implement
+// adaptors.Invalidator.
+func (j *JwtVerifier) InvalidateKeys() error {
+	invalidator, ok := j.Adaptor.(adaptors.Invalidator)
+	if !ok {
+		return fmt.Errorf("the adaptor %T does not support invalidation", j.Adaptor)
+	}
+	status, ok := j.metadataStatus.Load().(metadataStatus)
+	if !ok {
+		// no key set can have been fetched without the metadata
+		return nil
+	}
+	return invalidator.InvalidateKeySet(status.jwksUri)
+}
+
+func removeString(values []string, value string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
 }
 
 func (j *JwtVerifier) isValidJwt(jwt string) (bool, error) {
@@ -402,13 +1022,28 @@ func (j *JwtVerifier) isValidJwt(jwt string) (bool, error) {
 		return false, fmt.Errorf("the tokens header must contain a 'kid'")
 	}
 
-	if jsonObject["alg"] != "RS256" {
+	if !isAllowedAlgorithm(jsonObject["alg"]) {
 		return false, fmt.Errorf("the only supported alg is RS256")
 	}
 
 	return true, nil
 }
 
+// tokenHeader returns the decoded header of jwt, or nil when it cannot be
+// decoded
+func tokenHeader(jwt string) map[string]interface{} {
+	encoded := strings.SplitN(jwt, ".", 2)[0]
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil
+	}
+	var header map[string]interface{}
+	if json.Unmarshal(decoded, &header) != nil {
+		return nil
+	}
+	return header
+}
+
 func padHeader(header string) string {
 	if i := len(header) % 4; i != 0 {
 		header += strings.Repeat("=", 4-i)
@@ -0,0 +1,125 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// Keys of the fields logged by the verifier
+const (
+	FieldIssuer      = "issuer"
+	FieldTokenType   = "token_type"
+	FieldToken       = "token_fingerprint"
+	FieldKeyId       = "kid"
+	FieldKeyIds      = "kids"
+	FieldTokenIssuer = "iss"
+	FieldSubject     = "sub_hash"
+	FieldReason      = "reason"
+	FieldUrl         = "url"
+	FieldStatusCode  = "status_code"
+	FieldDuration    = "duration"
+	FieldNotModified = "not_modified"
+	FieldAdded       = "added"
+	FieldRemoved     = "removed"
+	FieldError       = "error"
+)
+
+// Logger receives structured log records from the verifier. Records never
+// contain raw tokens, only their Fingerprint.
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// Field is a key and value attached to a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Nop is a Logger that discards every record.
+type Nop struct{}
+
+func (Nop) Log(context.Context, Level, string, ...Field) {}
+
+// Fingerprint identifies a token in logs without revealing it. It is the
+// first 16 hex digits of the SHA-256 of the token.
+func Fingerprint(token string) string {
+	return hash(token)
+}
+
+// HashSubject hides the subject of a token, which is often an email
+// address, while still allowing records of the same subject to be grouped.
+func HashSubject(sub string) string {
+	return hash(sub)
+}
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// LogFetch logs a request for resource to issuer at LevelWarn when it failed
+// and at LevelDebug otherwise. statusCode is zero when the issuer did not
+// answer.
+func LogFetch(l Logger, issuer, resource, url string, statusCode int, d time.Duration, err error) {
+	fields := []Field{F(FieldIssuer, issuer), F(FieldUrl, url), F(FieldDuration, d)}
+	switch {
+	case err != nil:
+		l.Log(context.Background(), LevelWarn, "request for "+resource+" failed", append(fields, F(FieldError, err.Error()))...)
+	case statusCode == http.StatusNotModified:
+		l.Log(context.Background(), LevelDebug, "revalidated "+resource, append(fields, F(FieldNotModified, true))...)
+	case statusCode < 200 || statusCode >= 300:
+		l.Log(context.Background(), LevelWarn, "request for "+resource+" was not successful", append(fields, F(FieldStatusCode, statusCode))...)
+	default:
+		l.Log(context.Background(), LevelDebug, "fetched "+resource, append(fields, F(FieldStatusCode, statusCode))...)
+	}
+}
+
+// Nop implements the Logger interface
+var _ Logger = Nop{}
@@ -0,0 +1,46 @@
+//go:build go1.21
+
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogWritesFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlog(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	logger.Log(context.Background(), LevelDebug, "dropped below the handler level")
+	logger.Log(context.Background(), LevelWarn, "token verification failed",
+		F(FieldIssuer, "https://example.com"), F(FieldToken, Fingerprint("header.payload.signature")), F(FieldReason, "expired"))
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "WARN", record["level"])
+	require.Equal(t, "token verification failed", record["msg"])
+	require.Equal(t, "https://example.com", record[FieldIssuer])
+	require.Equal(t, "expired", record[FieldReason])
+	require.Len(t, record[FieldToken], 16)
+}
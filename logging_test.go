@@ -0,0 +1,159 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/logging"
+	"github.com/stretchr/testify/require"
+)
+
+// logRecord is a record kept by recordingLogger
+type logRecord struct {
+	level  logging.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger keeps every record it receives
+type recordingLogger struct {
+	mutex   sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) Log(_ context.Context, level logging.Level, msg string, fields ...logging.Field) {
+	record := logRecord{level: level, msg: msg, fields: map[string]interface{}{}}
+	for _, f := range fields {
+		record.fields[f.Key] = f.Value
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.records = append(l.records, record)
+}
+
+func (l *recordingLogger) find(msg string) (logRecord, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, record := range l.records {
+		if record.msg == msg {
+			return record, true
+		}
+	}
+	return logRecord{}, false
+}
+
+func TestLoggerRedactsFailedVerification(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	logger := &recordingLogger{}
+	jvs := JwtVerifier{
+		Issuer:           testIssuer,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Logger:           logger,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["aud"] = "api://other"
+	token := key.Sign(t, claims)
+	_, err = jv.VerifyAccessToken(token)
+	require.Error(t, err)
+
+	record, ok := logger.find("token verification failed")
+	require.True(t, ok)
+	require.Equal(t, logging.LevelInfo, record.level)
+	require.Equal(t, "invalid_audience", record.fields[logging.FieldReason])
+	require.Equal(t, logging.Fingerprint(token), record.fields[logging.FieldToken])
+	require.Equal(t, "kid-1", record.fields[logging.FieldKeyId])
+	require.Equal(t, testIssuer, record.fields[logging.FieldTokenIssuer])
+	require.Equal(t, logging.HashSubject("user@example.com"), record.fields[logging.FieldSubject])
+
+	_, ok = logger.find("fetched discovery document")
+	require.True(t, ok)
+	fetched, ok := logger.find("fetched key set")
+	require.True(t, ok)
+	require.Equal(t, testIssuer, fetched.fields[logging.FieldIssuer])
+
+	for _, record := range logger.records {
+		for _, value := range record.fields {
+			text := fmt.Sprint(value)
+			require.NotContains(t, text, token)
+			require.NotContains(t, text, strings.Split(token, ".")[1])
+			require.NotContains(t, text, "user@example.com")
+		}
+	}
+}
+
+func TestLoggerReportsUnavailableIssuer(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	httpmock.RegisterResponder("GET", testIssuer+"/.well-known/openid-configuration",
+		httpmock.NewStringResponder(200, `{"issuer":"https://other.example.com","jwks_uri":"`+testIssuer+`/v1/keys"}`))
+
+	logger := &recordingLogger{}
+	jvs := JwtVerifier{Issuer: testIssuer, Logger: logger}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.Error(t, err)
+
+	invalid, ok := logger.find("discovery document is not valid for the issuer")
+	require.True(t, ok)
+	require.Equal(t, logging.LevelError, invalid.level)
+	failed, ok := logger.find("token verification failed")
+	require.True(t, ok)
+	require.Equal(t, logging.LevelWarn, failed.level)
+	require.Equal(t, "metadata_unavailable", failed.fields[logging.FieldReason])
+}
+
+func TestLoggerReportsKeyRotation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	oldKey, newKey := testissuer.NewKey(t, "kid-1"), testissuer.NewKey(t, "kid-2")
+	testissuer.Register(t, oldKey)
+
+	logger := &recordingLogger{}
+	jvs := JwtVerifier{Issuer: testIssuer, Logger: logger}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(oldKey.Sign(t, validClaims()))
+	require.NoError(t, err)
+
+	testissuer.Register(t, newKey)
+	require.NoError(t, jv.InvalidateKeys())
+	_, err = jv.VerifyAccessToken(newKey.Sign(t, validClaims()))
+	require.NoError(t, err)
+
+	rotated, ok := logger.find("key set rotated")
+	require.True(t, ok)
+	require.Equal(t, logging.LevelInfo, rotated.level)
+	require.Equal(t, []string{"kid-2"}, rotated.fields[logging.FieldAdded])
+	require.Equal(t, []string{"kid-1"}, rotated.fields[logging.FieldRemoved])
+}
@@ -0,0 +1,221 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/replay"
+	"github.com/okta/okta-jwt-verifier-golang/v2/tracing"
+)
+
+const (
+	// LogoutTokenType is the `typ` header of logout tokens
+	LogoutTokenType = "logout+jwt"
+	// BackChannelLogoutEvent is the member of the `events` claim of logout
+	// tokens
+	BackChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+)
+
+// VerifyLogoutToken verifies a logout token of OpenID Connect Back-Channel
+// Logout 1.0. Its `aud` must match the client id of ClaimsToValidate, which
+// is therefore required. Its `jti` is recorded in the Replay store, or in a
+// store kept by the verifier when Replay is not set, so that it is accepted
+// once.
+func (j *JwtVerifier) VerifyLogoutToken(jwt string) (*Jwt, error) {
+	return j.VerifyLogoutTokenContext(context.Background(), jwt)
+}
+
+// VerifyLogoutTokenContext verifies a logout token like VerifyLogoutToken.
+// Fetching the metadata and key set stops waiting once ctx is done.
+func (j *JwtVerifier) VerifyLogoutTokenContext(ctx context.Context, jwt string) (*Jwt, error) {
+	start := time.Now()
+	ctx, span := j.startVerification(ctx, tracing.SpanVerifyLogoutToken, "logout_token", jwt)
+	token, err := j.verifyLogoutToken(ctx, jwt)
+	j.endVerification(ctx, span, "logout_token", jwt, token, start, err)
+	return token, err
+}
+
+func (j *JwtVerifier) verifyLogoutToken(ctx context.Context, jwt string) (*Jwt, error) {
+	validJwt, err := j.isValidJwt(jwt)
+	if !validJwt {
+		return nil, errors.VerificationError(errors.ReasonMalformed, fmt.Errorf("token is not valid: %w", err))
+	}
+	if typ, _ := tokenHeader(jwt)["typ"].(string); !isLogoutTokenType(typ) {
+		return nil, errors.VerificationError(errors.ReasonLogoutToken,
+			fmt.Errorf("the token type %q is not %s", typ, LogoutTokenType))
+	}
+	// the audience of logout tokens must be validated (section 2.6), or the
+	// logout tokens of the issuer's other clients would end our sessions
+	if j.ClaimsToValidate["aud"] == "" {
+		return nil, errors.VerificationError(errors.ReasonAudience,
+			fmt.Errorf("the `Audience` of logout tokens cannot be validated, ClaimsToValidate has no 'aud'"))
+	}
+
+	resp, err := j.decodeJwt(ctx, jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	token := resp.(map[string]interface{})
+
+	myJwt := Jwt{
+		Claims: token,
+	}
+
+	err = j.validateIss(token["iss"])
+	if err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonIssuer, fmt.Errorf("the `Issuer` was not able to be validated. %w", err))
+	}
+
+	err = j.validateAudience(token["aud"])
+	if err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonAudience, fmt.Errorf("the `Audience` was not able to be validated. %w", err))
+	}
+
+	err = j.validateExp(token["exp"])
+	if err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonExpired, fmt.Errorf("the `Expiration` was not able to be validated. %w", err))
+	}
+
+	err = j.validateIat(token["iat"])
+	if err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonIssuedAt, fmt.Errorf("the `Issued At` was not able to be validated. %w", err))
+	}
+
+	err = validateLogoutClaims(token)
+	if err != nil {
+		return &myJwt, errors.VerificationError(errors.ReasonLogoutToken, err)
+	}
+
+	err = j.checkReplay(ctx, j.logouts, jwt, token)
+	if err != nil {
+		return &myJwt, err
+	}
+
+	return &myJwt, nil
+}
+
+// isLogoutTokenType reports whether typ is the type of logout tokens, which
+// may be written as a media type (RFC 7515 section 4.1.9)
+func isLogoutTokenType(typ string) bool {
+	typ = strings.ToLower(typ)
+	return typ == LogoutTokenType || typ == "application/"+LogoutTokenType
+}
+
+// validateLogoutClaims checks the claims that distinguish logout tokens from
+// other tokens of the issuer (section 2.4)
+func validateLogoutClaims(claims map[string]interface{}) error {
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[BackChannelLogoutEvent].(map[string]interface{}); !ok {
+		return fmt.Errorf("the `events` claim has no %s event", BackChannelLogoutEvent)
+	}
+	sub, _ := claims["sub"].(string)
+	sid, _ := claims["sid"].(string)
+	if sub == "" && sid == "" {
+		return fmt.Errorf("the token has neither a `sub` nor a `sid` claim")
+	}
+	if _, ok := claims["nonce"]; ok {
+		return fmt.Errorf("the token has a `nonce` claim")
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return fmt.Errorf("the token has no `jti` claim")
+	}
+	return nil
+}
+
+// Logout is a verified back-channel logout request. Subject or SessionId may
+// be empty, the sessions to end are those matching every one that is set.
+type Logout struct {
+	Subject   string
+	SessionId string
+	Jwt       *Jwt
+}
+
+// LogoutHandler receives the back-channel logout requests of the issuer: it
+// verifies the `logout_token` of form encoded POST requests and calls
+// Logout to end the sessions it designates. Requests are answered with 200
+// once Logout returns, 400 when the token is invalid or Logout fails, and 503
+// when the issuer's keys cannot be fetched.
+//
+// When Logout fails the `jti` of the token is released from the replay
+// store, so that the issuer can retry, provided the store implements
+// replay.Releaser as the default one does.
+type LogoutHandler struct {
+	Verifier *JwtVerifier
+	// Logout is required, requests are answered with 500 without it
+	Logout func(ctx context.Context, logout Logout) error
+}
+
+func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Logout == nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logoutToken := r.PostFormValue("logout_token")
+	if logoutToken == "" {
+		logoutError(w, http.StatusBadRequest, "The request has no logout_token")
+		return
+	}
+
+	jwt, err := h.Verifier.VerifyLogoutTokenContext(r.Context(), logoutToken)
+	if err != nil {
+		if errors.ReasonOf(err).Unavailable() {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		logoutError(w, http.StatusBadRequest, "The logout_token is invalid")
+		return
+	}
+
+	logout := Logout{Jwt: jwt}
+	logout.Subject, _ = jwt.Claims["sub"].(string)
+	logout.SessionId, _ = jwt.Claims["sid"].(string)
+	if err := h.Logout(r.Context(), logout); err != nil {
+		if releaser, ok := h.Verifier.logouts.(replay.Releaser); ok {
+			_ = releaser.Release(r.Context(), replay.Id(logoutToken, jwt.Claims))
+		}
+		logoutError(w, http.StatusBadRequest, "The logout failed")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// logoutError answers with an OAuth error, section 2.8
+func logoutError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             "invalid_request",
+		"error_description": description,
+	})
+}
+
+// LogoutHandler implements the http.Handler interface
+var _ http.Handler = (*LogoutHandler)(nil)
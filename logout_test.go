@@ -0,0 +1,186 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/stretchr/testify/require"
+)
+
+func logoutClaims(jti string) map[string]interface{} {
+	claims := validClaims()
+	delete(claims, "cid")
+	claims["aud"] = "client"
+	claims["jti"] = jti
+	claims["sid"] = "session-1"
+	claims["events"] = map[string]interface{}{BackChannelLogoutEvent: map[string]interface{}{}}
+	return claims
+}
+
+func TestVerifyLogoutToken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{Issuer: testIssuer, ClaimsToValidate: map[string]string{"aud": "client"}}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	token := key.SignTyped(t, LogoutTokenType, logoutClaims("1"))
+	jwt, err := jv.VerifyLogoutToken(token)
+	require.NoError(t, err)
+	require.Equal(t, "session-1", jwt.Claims["sid"])
+	_, err = jv.VerifyLogoutToken(token)
+	require.Equal(t, errors.ReasonReplayed, errors.ReasonOf(err))
+
+	invalid := map[string]func(claims map[string]interface{}){
+		"no events": func(claims map[string]interface{}) { delete(claims, "events") },
+		"other event": func(claims map[string]interface{}) {
+			claims["events"] = map[string]interface{}{"http://example.com/event": map[string]interface{}{}}
+		},
+		"no sub nor sid": func(claims map[string]interface{}) {
+			delete(claims, "sub")
+			delete(claims, "sid")
+		},
+		"nonce":  func(claims map[string]interface{}) { claims["nonce"] = "n-1" },
+		"no jti": func(claims map[string]interface{}) { delete(claims, "jti") },
+	}
+	for name, modify := range invalid {
+		claims := logoutClaims(name)
+		modify(claims)
+		_, err = jv.VerifyLogoutToken(key.SignTyped(t, LogoutTokenType, claims))
+		require.Equal(t, errors.ReasonLogoutToken, errors.ReasonOf(err), name)
+	}
+
+	// id tokens are not logout tokens
+	_, err = jv.VerifyLogoutToken(key.Sign(t, logoutClaims("2")))
+	require.Equal(t, errors.ReasonLogoutToken, errors.ReasonOf(err))
+
+	claims := logoutClaims("3")
+	claims["aud"] = "another-client"
+	_, err = jv.VerifyLogoutToken(key.SignTyped(t, LogoutTokenType, claims))
+	require.Equal(t, errors.ReasonAudience, errors.ReasonOf(err))
+
+	_, err = jv.VerifyLogoutToken(key.SignTyped(t, "application/"+LogoutTokenType, logoutClaims("4")))
+	require.NoError(t, err)
+
+	// the audience cannot be left unchecked
+	unchecked, err := (&JwtVerifier{Issuer: testIssuer}).New()
+	require.NoError(t, err)
+	_, err = unchecked.VerifyLogoutToken(key.SignTyped(t, LogoutTokenType, logoutClaims("5")))
+	require.Equal(t, errors.ReasonAudience, errors.ReasonOf(err))
+}
+
+func TestLogoutHandler(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{Issuer: testIssuer, ClaimsToValidate: map[string]string{"aud": "client"}}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	var logouts []Logout
+	h := &LogoutHandler{Verifier: jv, Logout: func(_ context.Context, logout Logout) error {
+		logouts = append(logouts, logout)
+		if logout.SessionId == "failing" {
+			return fmt.Errorf("the session store is down")
+		}
+		return nil
+	}}
+	post := func(token string) *httptest.ResponseRecorder {
+		form := url.Values{"logout_token": {token}}
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	token := key.SignTyped(t, LogoutTokenType, logoutClaims("1"))
+	rec := post(token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	require.Len(t, logouts, 1)
+	require.Equal(t, "user@example.com", logouts[0].Subject)
+	require.Equal(t, "session-1", logouts[0].SessionId)
+
+	rec = post(token)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.JSONEq(t, `{"error":"invalid_request","error_description":"The logout_token is invalid"}`, rec.Body.String())
+	require.Len(t, logouts, 1)
+
+	failing := logoutClaims("2")
+	failing["sid"] = "failing"
+	rec = post(key.SignTyped(t, LogoutTokenType, failing))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.JSONEq(t, `{"error":"invalid_request","error_description":"The logout failed"}`, rec.Body.String())
+
+	rec = post("")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logout", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestLogoutHandlerAcceptsRetriesOfFailedLogouts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{Issuer: testIssuer, ClaimsToValidate: map[string]string{"aud": "client"}}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	calls := 0
+	h := &LogoutHandler{Verifier: jv, Logout: func(_ context.Context, _ Logout) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("the session store is down")
+		}
+		return nil
+	}}
+	form := url.Values{"logout_token": {key.SignTyped(t, LogoutTokenType, logoutClaims("1"))}}
+	post := func(h http.Handler) int {
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusBadRequest, post(h))
+	require.Equal(t, http.StatusOK, post(h))
+	require.Equal(t, http.StatusBadRequest, post(h))
+	require.Equal(t, 2, calls)
+
+	require.Equal(t, http.StatusInternalServerError, post(&LogoutHandler{Verifier: jv}))
+}
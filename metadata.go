@@ -0,0 +1,118 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ProviderMetadata is the discovery document published by the issuer. Fields
+// that are not modelled here are available in Extra.
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint         string `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint,omitempty"`
+	JwksUri               string `json:"jwks_uri"`
+	RegistrationEndpoint  string `json:"registration_endpoint,omitempty"`
+	IntrospectionEndpoint string `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint    string `json:"revocation_endpoint,omitempty"`
+	EndSessionEndpoint    string `json:"end_session_endpoint,omitempty"`
+
+	ScopesSupported                            []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                     []string `json:"response_types_supported,omitempty"`
+	ResponseModesSupported                     []string `json:"response_modes_supported,omitempty"`
+	GrantTypesSupported                        []string `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported,omitempty"`
+	ClaimsSupported                            []string `json:"claims_supported,omitempty"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported,omitempty"`
+	IdTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+
+	// Extra holds every field of the document without a dedicated field above
+	Extra map[string]interface{} `json:"-"`
+}
+
+var providerMetadataFields = jsonFieldNames(reflect.TypeOf(ProviderMetadata{}))
+
+// Metadata returns the issuer's discovery document. It is served from the same
+// cache the verifier uses, so it does not cause an additional request.
+func (j *JwtVerifier) Metadata(ctx context.Context) (*ProviderMetadata, error) {
+	metadata, err := j.getMetaDataContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newProviderMetadata(metadata)
+}
+
+func newProviderMetadata(metadata map[string]interface{}) (*ProviderMetadata, error) {
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode metadata: %w", err)
+	}
+	pm := &ProviderMetadata{}
+	if err := json.Unmarshal(raw, pm); err != nil {
+		return nil, fmt.Errorf("could not decode metadata: %w", err)
+	}
+
+	pm.Extra = map[string]interface{}{}
+	for k, v := range metadata {
+		if !providerMetadataFields[k] {
+			pm.Extra[k] = v
+		}
+	}
+	return pm, nil
+}
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// metadataCodec serializes discovery documents for caches that store them
+// outside of the process. Decoded documents are validated again.
+type metadataCodec struct {
+	verifier *JwtVerifier
+}
+
+func (c metadataCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (c metadataCodec) Decode(data []byte) (interface{}, error) {
+	metadata := make(map[string]interface{})
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	if err := c.verifier.validateMetaData(metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
@@ -0,0 +1,68 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataIsTypedAndServedFromCache(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://example.com/.well-known/openid-configuration",
+		httpmock.NewStringResponder(200, `{
+			"issuer": "https://example.com",
+			"jwks_uri": "https://example.com/keys",
+			"introspection_endpoint": "https://example.com/introspect",
+			"scopes_supported": ["openid", "profile"],
+			"id_token_signing_alg_values_supported": ["RS256"],
+			"request_parameter_supported": true
+		}`))
+
+	jvs := JwtVerifier{Issuer: "https://example.com"}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	metadata, err := jv.Metadata(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", metadata.Issuer)
+	require.Equal(t, "https://example.com/keys", metadata.JwksUri)
+	require.Equal(t, "https://example.com/introspect", metadata.IntrospectionEndpoint)
+	require.Equal(t, []string{"openid", "profile"}, metadata.ScopesSupported)
+	require.Equal(t, map[string]interface{}{"request_parameter_supported": true}, metadata.Extra)
+
+	_, err = jv.Metadata(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestMetadataHonorsCanceledContext(t *testing.T) {
+	jvs := JwtVerifier{Issuer: "https://example.com"}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = jv.Metadata(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,139 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+)
+
+// Resources fetched from the issuer
+const (
+	ResourceMetadata = "metadata"
+	ResourceKeys     = "jwks"
+)
+
+// CacheResult is the outcome of a cache lookup.
+type CacheResult string
+
+const (
+	CacheHit  CacheResult = "hit"
+	CacheMiss CacheResult = "miss"
+	// CacheStale is a hit on a value older than the verifier's Timeout, kept
+	// alive by the issuer's caching headers or a persistent cache
+	CacheStale CacheResult = "stale"
+	// CacheFailure is a hit on a cached lookup error
+	CacheFailure CacheResult = "failure"
+)
+
+// Observer receives events from the verifier. Its methods are called
+// synchronously on the verification path and must not block.
+type Observer interface {
+	VerificationCompleted(VerificationEvent)
+	CacheAccessed(CacheEvent)
+	FetchCompleted(FetchEvent)
+	KeyRotationDetected(KeyRotationEvent)
+}
+
+// VerificationEvent is the outcome of verifying a token. Reason is empty when
+// the token is valid.
+type VerificationEvent struct {
+	Issuer    string
+	TokenType string
+	Reason    errors.Reason
+	Duration  time.Duration
+}
+
+// CacheEvent is a lookup of a resource in its cache.
+type CacheEvent struct {
+	Issuer   string
+	Resource string
+	Key      string
+	Result   CacheResult
+}
+
+// FetchEvent is a request for a resource to the issuer. StatusCode is zero
+// when no response was received.
+type FetchEvent struct {
+	Issuer     string
+	Resource   string
+	Url        string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// KeyRotationEvent reports a key set whose key ids changed since it was last
+// fetched.
+type KeyRotationEvent struct {
+	Issuer  string
+	JwksUri string
+	Added   []string
+	Removed []string
+}
+
+// Nop is an Observer that ignores every event.
+type Nop struct{}
+
+func (Nop) VerificationCompleted(VerificationEvent) {}
+func (Nop) CacheAccessed(CacheEvent)                {}
+func (Nop) FetchCompleted(FetchEvent)               {}
+func (Nop) KeyRotationDetected(KeyRotationEvent)    {}
+
+// CacheResultOf tells what a Get of key on c is about to return, without
+// looking it up. Values older than staleAfter are reported as stale. It
+// requires c to implement utils.ManagedCacher.
+func CacheResultOf(c utils.Cacher, key string, staleAfter time.Duration) (CacheResult, bool) {
+	mc, ok := c.(utils.ManagedCacher)
+	if !ok {
+		return "", false
+	}
+	entry, found := mc.Peek(key)
+	switch {
+	case !found:
+		return CacheMiss, true
+	case entry.Err != nil:
+		return CacheFailure, true
+	case staleAfter > 0 && entry.Age() > staleAfter:
+		return CacheStale, true
+	default:
+		return CacheHit, true
+	}
+}
+
+// KeyIdChanges returns the key ids added and removed between two key sets.
+func KeyIdChanges(previous, current []string) (added, removed []string) {
+	before := map[string]bool{}
+	for _, kid := range previous {
+		before[kid] = true
+	}
+	after := map[string]bool{}
+	for _, kid := range current {
+		after[kid] = true
+		if !before[kid] {
+			added = append(added, kid)
+		}
+	}
+	for _, kid := range previous {
+		if !after[kid] {
+			removed = append(removed, kid)
+		}
+	}
+	return added, removed
+}
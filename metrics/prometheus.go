@@ -0,0 +1,214 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultBuckets are the upper bounds, in seconds, of the duration
+// histograms
+var defaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Prometheus is an Observer that aggregates events into counters and
+// histograms and serves them in the Prometheus text exposition format.
+type Prometheus struct {
+	mutex                sync.Mutex
+	verifications        *counterVec
+	verificationDuration *histogramVec
+	cacheRequests        *counterVec
+	fetches              *counterVec
+	fetchDuration        *histogramVec
+	keyRotations         *counterVec
+}
+
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		verifications: newCounterVec("okta_jwt_verifier_verifications_total",
+			"Tokens verified, by result.", "issuer", "token_type", "result"),
+		verificationDuration: newHistogramVec("okta_jwt_verifier_verification_duration_seconds",
+			"Time spent verifying tokens.", "issuer", "token_type"),
+		cacheRequests: newCounterVec("okta_jwt_verifier_cache_requests_total",
+			"Cache lookups of issuer resources, by result.", "issuer", "resource", "result"),
+		fetches: newCounterVec("okta_jwt_verifier_fetches_total",
+			"Requests to the issuer, by HTTP status.", "issuer", "resource", "status"),
+		fetchDuration: newHistogramVec("okta_jwt_verifier_fetch_duration_seconds",
+			"Time spent fetching issuer resources.", "issuer", "resource"),
+		keyRotations: newCounterVec("okta_jwt_verifier_key_rotations_total",
+			"Key sets whose key ids changed.", "issuer"),
+	}
+}
+
+func (p *Prometheus) VerificationCompleted(e VerificationEvent) {
+	result := "valid"
+	if e.Reason != "" {
+		result = string(e.Reason)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.verifications.inc(e.Issuer, e.TokenType, result)
+	p.verificationDuration.observe(e.Duration.Seconds(), e.Issuer, e.TokenType)
+}
+
+func (p *Prometheus) CacheAccessed(e CacheEvent) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.cacheRequests.inc(e.Issuer, e.Resource, string(e.Result))
+}
+
+func (p *Prometheus) FetchCompleted(e FetchEvent) {
+	status := "error"
+	if e.StatusCode != 0 {
+		status = strconv.Itoa(e.StatusCode)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.fetches.inc(e.Issuer, e.Resource, status)
+	p.fetchDuration.observe(e.Duration.Seconds(), e.Issuer, e.Resource)
+}
+
+func (p *Prometheus) KeyRotationDetected(e KeyRotationEvent) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.keyRotations.inc(e.Issuer)
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format.
+// The metrics are rendered before writing, so that a slow scraper does not
+// hold back the verifications reporting to p.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	p.mutex.Lock()
+	p.verifications.write(&buf)
+	p.verificationDuration.write(&buf)
+	p.cacheRequests.write(&buf)
+	p.fetches.write(&buf)
+	p.fetchDuration.write(&buf)
+	p.keyRotations.write(&buf)
+	p.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// Prometheus implements the Observer and http.Handler interfaces
+var (
+	_ Observer     = (*Prometheus)(nil)
+	_ http.Handler = (*Prometheus)(nil)
+)
+
+type counterVec struct {
+	name, help string
+	labels     []string
+	values     map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+func (c *counterVec) inc(values ...string) {
+	c.values[formatLabels(c.labels, values)]++
+}
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, labels := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, labels, formatFloat(c.values[labels]))
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	values     map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: defaultBuckets, values: map[string]*histogram{}}
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	labels := formatLabels(h.labels, values)
+	hist, ok := h.values[labels]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[labels] = hist
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, labels := range keys {
+		hist := h.values[labels]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, labels, formatFloat(bound), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, labels, hist.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, labels, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, labels, hist.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, labelEscaper.Replace(values[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	p := NewPrometheus()
+	p.VerificationCompleted(VerificationEvent{Issuer: "https://a", TokenType: "access_token", Duration: 2 * time.Millisecond})
+	p.VerificationCompleted(VerificationEvent{Issuer: "https://a", TokenType: "access_token", Reason: errors.ReasonExpired})
+	p.CacheAccessed(CacheEvent{Issuer: "https://a", Resource: ResourceKeys, Result: CacheHit})
+	p.FetchCompleted(FetchEvent{Issuer: "https://a", Resource: ResourceMetadata, StatusCode: 200, Duration: 30 * time.Millisecond})
+	p.FetchCompleted(FetchEvent{Issuer: "https://a", Resource: ResourceMetadata})
+	p.KeyRotationDetected(KeyRotationEvent{Issuer: `say "hi"`})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	require.Contains(t, body, "# TYPE okta_jwt_verifier_verifications_total counter\n")
+	require.Contains(t, body, `okta_jwt_verifier_verifications_total{issuer="https://a",token_type="access_token",result="valid"} 1`)
+	require.Contains(t, body, `okta_jwt_verifier_verifications_total{issuer="https://a",token_type="access_token",result="expired"} 1`)
+	require.Contains(t, body, `okta_jwt_verifier_cache_requests_total{issuer="https://a",resource="jwks",result="hit"} 1`)
+	require.Contains(t, body, `okta_jwt_verifier_fetches_total{issuer="https://a",resource="metadata",status="200"} 1`)
+	require.Contains(t, body, `okta_jwt_verifier_fetches_total{issuer="https://a",resource="metadata",status="error"} 1`)
+	require.Contains(t, body, `okta_jwt_verifier_fetch_duration_seconds_bucket{issuer="https://a",resource="metadata",le="0.025"} 1`)
+	require.Contains(t, body, `okta_jwt_verifier_fetch_duration_seconds_bucket{issuer="https://a",resource="metadata",le="0.05"} 2`)
+	require.Contains(t, body, `okta_jwt_verifier_fetch_duration_seconds_count{issuer="https://a",resource="metadata"} 2`)
+	require.Contains(t, body, `okta_jwt_verifier_key_rotations_total{issuer="say \"hi\""} 1`)
+}
+
+// stalledWriter blocks writes until release is closed
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(b []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestPrometheusSlowScraperDoesNotBlockEvents(t *testing.T) {
+	p := NewPrometheus()
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), writing: make(chan struct{}), release: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		close(served)
+	}()
+	<-w.writing
+
+	reported := make(chan struct{})
+	go func() {
+		p.VerificationCompleted(VerificationEvent{Issuer: "https://a", TokenType: "access_token"})
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("the event waited on the scraper")
+	}
+	close(w.release)
+	<-served
+}
+
+func TestKeyIdChanges(t *testing.T) {
+	added, removed := KeyIdChanges([]string{"a", "b"}, []string{"b", "c"})
+	require.Equal(t, []string{"c"}, added)
+	require.Equal(t, []string{"a"}, removed)
+
+	added, removed = KeyIdChanges([]string{"a"}, []string{"a"})
+	require.Empty(t, added)
+	require.Empty(t, removed)
+}
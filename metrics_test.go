@@ -0,0 +1,134 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver keeps every event it receives
+type recordingObserver struct {
+	mutex         sync.Mutex
+	verifications []metrics.VerificationEvent
+	caches        []metrics.CacheEvent
+	fetches       []metrics.FetchEvent
+	rotations     []metrics.KeyRotationEvent
+}
+
+func (o *recordingObserver) VerificationCompleted(e metrics.VerificationEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.verifications = append(o.verifications, e)
+}
+
+func (o *recordingObserver) CacheAccessed(e metrics.CacheEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.caches = append(o.caches, e)
+}
+
+func (o *recordingObserver) FetchCompleted(e metrics.FetchEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.fetches = append(o.fetches, e)
+}
+
+func (o *recordingObserver) KeyRotationDetected(e metrics.KeyRotationEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.rotations = append(o.rotations, e)
+}
+
+func TestObserverReceivesVerificationEvents(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	observer := &recordingObserver{}
+	jvs := JwtVerifier{
+		Issuer:           testIssuer,
+		ClaimsToValidate: map[string]string{"aud": "api://default"},
+		Observer:         observer,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.NoError(t, err)
+	claims := validClaims()
+	claims["aud"] = "api://other"
+	_, err = jv.VerifyAccessToken(key.Sign(t, claims))
+	require.Error(t, err)
+
+	require.Len(t, observer.verifications, 3)
+	require.Equal(t, errors.Reason(""), observer.verifications[0].Reason)
+	require.Equal(t, "access_token", observer.verifications[0].TokenType)
+	require.Equal(t, testIssuer, observer.verifications[0].Issuer)
+	require.Equal(t, errors.ReasonAudience, observer.verifications[2].Reason)
+
+	require.Len(t, observer.fetches, 2)
+	require.Equal(t, metrics.ResourceMetadata, observer.fetches[0].Resource)
+	require.Equal(t, metrics.ResourceKeys, observer.fetches[1].Resource)
+	for _, fetch := range observer.fetches {
+		require.Equal(t, testIssuer, fetch.Issuer)
+		require.Equal(t, 200, fetch.StatusCode)
+	}
+
+	results := map[string][]metrics.CacheResult{}
+	for _, access := range observer.caches {
+		results[access.Resource] = append(results[access.Resource], access.Result)
+	}
+	hits := []metrics.CacheResult{metrics.CacheMiss, metrics.CacheHit, metrics.CacheHit}
+	require.Equal(t, hits, results[metrics.ResourceMetadata])
+	require.Equal(t, hits, results[metrics.ResourceKeys])
+}
+
+func TestObserverReceivesKeyRotation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	oldKey, newKey := testissuer.NewKey(t, "kid-1"), testissuer.NewKey(t, "kid-2")
+	testissuer.Register(t, oldKey)
+
+	observer := &recordingObserver{}
+	jvs := JwtVerifier{Issuer: testIssuer, Observer: observer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(oldKey.Sign(t, validClaims()))
+	require.NoError(t, err)
+	require.Empty(t, observer.rotations)
+
+	testissuer.Register(t, newKey)
+	require.NoError(t, jv.InvalidateKeys())
+	_, err = jv.VerifyAccessToken(newKey.Sign(t, validClaims()))
+	require.NoError(t, err)
+
+	require.Len(t, observer.rotations, 1)
+	require.Equal(t, testIssuer, observer.rotations[0].Issuer)
+	require.Equal(t, []string{"kid-2"}, observer.rotations[0].Added)
+	require.Equal(t, []string{"kid-1"}, observer.rotations[0].Removed)
+}
@@ -0,0 +1,163 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/okta/okta-jwt-verifier-golang/v2/dpop"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testverifier"
+	"github.com/stretchr/testify/require"
+)
+
+// newProver returns the thumbprint of a new client key and a function signing
+// proofs for requests to "/" with it
+func newProver(t *testing.T) (string, func(token, nonce string) string) {
+	t.Helper()
+	raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	private, err := jwk.FromRaw(raw)
+	require.NoError(t, err)
+	public, err := private.PublicKey()
+	require.NoError(t, err)
+	thumbprint, err := dpop.Thumbprint(public)
+	require.NoError(t, err)
+
+	prove := func(token, nonce string) string {
+		ath := sha256.Sum256([]byte(token))
+		jti := make([]byte, 16)
+		_, err := rand.Read(jti)
+		require.NoError(t, err)
+		claims := map[string]interface{}{
+			"jti": hex.EncodeToString(jti),
+			"htm": http.MethodGet,
+			"htu": "http://example.com/",
+			"iat": time.Now().Unix(),
+			"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+		}
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		headers := jws.NewHeaders()
+		require.NoError(t, headers.Set(jws.TypeKey, dpop.ProofType))
+		require.NoError(t, headers.Set(jws.JWKKey, public))
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+		proof, err := jws.Sign(payload, jws.WithKey(jwa.ES256, private, jws.WithProtectedHeaders(headers)))
+		require.NoError(t, err)
+		return string(proof)
+	}
+	return thumbprint, prove
+}
+
+func serveDPoP(h http.Handler, token, proof string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "DPoP "+token)
+	if proof != "" {
+		req.Header.Set("DPoP", proof)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBearerAcceptsDPoP(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	thumbprint, prove := newProver(t)
+	verifier, err := (&dpop.Verifier{Algorithms: []jwa.SignatureAlgorithm{jwa.ES256}}).New()
+	require.NoError(t, err)
+	h := (&Bearer{Verifier: jv, DPoP: verifier}).Handler(echoSubject)
+
+	bound := testissuer.Claims()
+	bound["cnf"] = map[string]interface{}{"jkt": thumbprint}
+	token := sign(bound)
+
+	proof := prove(token, "")
+	rec := serveDPoP(h, token, proof)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user@example.com", rec.Body.String())
+	rec = serveDPoP(h, token, proof)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `error_description="The DPoP proof was already used"`)
+
+	// bound tokens are not bearer tokens
+	rec = serve(h, "Bearer "+token)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	rec = serve((&Bearer{Verifier: jv}).Handler(echoSubject), "Bearer "+token)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serveDPoP(h, token, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `DPoP error="invalid_dpop_proof", error_description="The DPoP proof is invalid"`)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `algs="ES256"`)
+
+	// the proof must be signed by the key the token is bound to
+	_, otherProve := newProver(t)
+	rec = serveDPoP(h, token, otherProve(token, ""))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `DPoP error="invalid_token"`)
+
+	unbound := sign(testissuer.Claims())
+	rec = serveDPoP(h, unbound, prove(unbound, ""))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(h)
+	require.Equal(t, []string{`DPoP algs="ES256"`, `Bearer`}, rec.Header().Values("WWW-Authenticate"))
+}
+
+func TestBearerRequiresDPoPNonce(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	thumbprint, prove := newProver(t)
+	nonces, err := (&dpop.SignedNonces{}).New()
+	require.NoError(t, err)
+	verifier, err := (&dpop.Verifier{Nonces: nonces}).New()
+	require.NoError(t, err)
+	h := (&Bearer{Verifier: jv, DPoP: verifier}).Handler(echoSubject)
+
+	bound := testissuer.Claims()
+	bound["cnf"] = map[string]interface{}{"jkt": thumbprint}
+	token := sign(bound)
+
+	rec := serveDPoP(h, token, prove(token, ""))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="use_dpop_nonce"`)
+	nonce := rec.Header().Get("DPoP-Nonce")
+	require.NotEmpty(t, nonce)
+
+	rec = serveDPoP(h, token, prove(token, nonce))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,346 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package middleware
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang/v2"
+	"github.com/okta/okta-jwt-verifier-golang/v2/dpop"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/extractors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/mtls"
+	"github.com/okta/okta-jwt-verifier-golang/v2/replay"
+)
+
+// Error codes of RFC 6750 section 3.1
+const (
+	ErrorInvalidRequest    = "invalid_request"
+	ErrorInvalidToken      = "invalid_token"
+	ErrorInsufficientScope = "insufficient_scope"
+	// ErrorInvalidDPoPProof and ErrorUseDPoPNonce are the error codes of
+	// RFC 9449 section 12.2
+	ErrorInvalidDPoPProof = "invalid_dpop_proof"
+	ErrorUseDPoPNonce     = "use_dpop_nonce"
+)
+
+const (
+	schemeBearer = "Bearer"
+	schemeDPoP   = "DPoP"
+)
+
+// Bearer authenticates requests with an access token sent in the
+// `Authorization: Bearer` header (RFC 6750), or found by Extractor, and
+// stores the verified token in the request context, see JwtFromContext.
+//
+// Requests are answered with:
+//   - 400 and `invalid_request` when the token is not sent as accepted
+//   - 401 without an error code when no token is sent and Optional is false
+//   - 401 and `invalid_token` when the token is rejected
+//   - 403 and `insufficient_scope` when the token lacks one of the Scopes or
+//     does not satisfy the Policy
+//   - 503 when the issuer's metadata or keys cannot be fetched
+//
+// Access tokens bound to a DPoP key are only accepted with DPoP set, when
+// sent in an `Authorization: DPoP` header along a valid proof. Failures of
+// the proof are answered with 401 and `invalid_dpop_proof`, or
+// `use_dpop_nonce` and a `DPoP-Nonce` header when the proof lacks a valid
+// nonce.
+//
+// Access tokens bound to a client certificate (RFC 8705) are only accepted
+// from clients presenting that certificate, found by Certificate.
+type Bearer struct {
+	Verifier *jwtverifier.JwtVerifier
+	// Realm is sent in the WWW-Authenticate challenges when set
+	Realm string
+	// Scopes must all be granted to the token, through its `scp` or `scope`
+	// claim
+	Scopes []string
+	// Policy adds requirements per route, checked after Scopes
+	Policy *Policy
+	// Extractor finds the token of a request, it defaults to the Extractor of
+	// the Verifier
+	Extractor extractors.Extractor
+	// Optional lets requests without a token through, unauthenticated,
+	// unless the Policy has a requirement for them. Requests with an invalid
+	// token are still rejected.
+	Optional bool
+	// DPoP, when set, accepts DPoP-bound access tokens (RFC 9449)
+	DPoP *dpop.Verifier
+	// Certificate finds the client certificate that certificate-bound access
+	// tokens must match, it defaults to mtls.TLS()
+	Certificate mtls.Source
+}
+
+type jwtKey struct{}
+
+// ContextWithJwt returns a copy of ctx carrying jwt.
+func ContextWithJwt(ctx context.Context, jwt *jwtverifier.Jwt) context.Context {
+	return context.WithValue(ctx, jwtKey{}, jwt)
+}
+
+// JwtFromContext returns the token verified by the middleware, if any.
+func JwtFromContext(ctx context.Context) (*jwtverifier.Jwt, bool) {
+	jwt, ok := ctx.Value(jwtKey{}).(*jwtverifier.Jwt)
+	return jwt, ok
+}
+
+// Handler returns next wrapped with the authentication.
+func (b *Bearer) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, err := b.token(r)
+		if err != nil {
+			b.challenge(w, http.StatusBadRequest, schemeBearer, ErrorInvalidRequest, err.Error(), nil)
+			return
+		}
+		if token == "" {
+			// anonymous requests only reach the routes the Policy does not
+			// protect
+			if b.Optional && (b.Policy == nil || b.Policy.Requirement(r) == nil) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if b.DPoP != nil {
+				w.Header().Add("WWW-Authenticate", b.challengeValue(schemeDPoP, "", "", b.Scopes))
+			}
+			b.challenge(w, http.StatusUnauthorized, schemeBearer, "", "", b.Scopes)
+			return
+		}
+
+		jwt, err := b.Verifier.VerifyAccessTokenContext(r.Context(), token)
+		if err != nil {
+			reason := errors.ReasonOf(err)
+			if reason.Unavailable() {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			b.challenge(w, http.StatusUnauthorized, scheme, ErrorInvalidToken, describe(reason), nil)
+			return
+		}
+
+		if scheme == schemeDPoP {
+			if !b.checkProof(w, r, token, jwt) {
+				return
+			}
+		} else if dpop.Bound(jwt.Claims) {
+			b.challenge(w, http.StatusUnauthorized, schemeBearer, ErrorInvalidToken, describe(errors.ReasonBinding), nil)
+			return
+		}
+
+		if mtls.Bound(jwt.Claims) {
+			if err := b.checkCertificate(r, jwt); err != nil {
+				b.challenge(w, http.StatusUnauthorized, scheme, ErrorInvalidToken, describe(errors.ReasonOf(err)), nil)
+				return
+			}
+		}
+
+		if missing := MissingScopes(jwt, b.Scopes); len(missing) > 0 {
+			b.challenge(w, http.StatusForbidden, scheme, ErrorInsufficientScope,
+				fmt.Sprintf("The access token is missing the scopes: %s", strings.Join(missing, " ")), b.Scopes)
+			return
+		}
+
+		if b.Policy != nil {
+			if denial := b.Policy.Check(r, jwt); denial != nil {
+				b.challenge(w, http.StatusForbidden, scheme, ErrorInsufficientScope, denial.Description, denial.Scopes)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithJwt(r.Context(), jwt)))
+	})
+}
+
+// token returns the scheme and token of r, the DPoP scheme is only
+// recognized with DPoP set
+func (b *Bearer) token(r *http.Request) (string, string, error) {
+	if b.DPoP != nil {
+		if values := r.Header.Values("Authorization"); len(values) == 1 {
+			if prefix, _, _ := strings.Cut(strings.TrimSpace(values[0]), " "); strings.EqualFold(prefix, schemeDPoP) {
+				token, err := extractors.Header("Authorization", schemeDPoP).Extract(r)
+				return schemeDPoP, token, err
+			}
+		}
+	}
+	token, err := b.extractor().Extract(r)
+	return schemeBearer, token, err
+}
+
+// checkProof verifies the DPoP proof of r and its binding to jwt, and answers
+// the request when they fail
+func (b *Bearer) checkProof(w http.ResponseWriter, r *http.Request, token string, jwt *jwtverifier.Jwt) bool {
+	proof, err := b.DPoP.VerifyBoundRequest(r, token, jwt.Claims)
+	if err == nil {
+		if b.DPoP.Nonces != nil {
+			if nonce, nonceErr := b.DPoP.Nonces.Nonce(); nonceErr == nil && nonce != proof.Claims["nonce"] {
+				w.Header().Set("DPoP-Nonce", nonce)
+			}
+		}
+		return true
+	}
+
+	switch reason := errors.ReasonOf(err); reason {
+	case errors.ReasonUseNonce:
+		nonce, nonceErr := b.DPoP.Nonces.Nonce()
+		if nonceErr != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return false
+		}
+		w.Header().Set("DPoP-Nonce", nonce)
+		b.challenge(w, http.StatusUnauthorized, schemeDPoP, ErrorUseDPoPNonce, "The DPoP proof must carry a nonce issued by the server", nil)
+	case errors.ReasonBinding:
+		b.challenge(w, http.StatusUnauthorized, schemeDPoP, ErrorInvalidToken, describe(reason), nil)
+	default:
+		if reason.Unavailable() {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return false
+		}
+		b.challenge(w, http.StatusUnauthorized, schemeDPoP, ErrorInvalidDPoPProof, describeProof(err), nil)
+	}
+	return false
+}
+
+func (b *Bearer) extractor() extractors.Extractor {
+	if b.Extractor != nil {
+		return b.Extractor
+	}
+	if b.Verifier.Extractor != nil {
+		return b.Verifier.Extractor
+	}
+	return extractors.AuthorizationHeader()
+}
+
+// checkCertificate verifies that the client certificate of r is the one jwt
+// is bound to
+func (b *Bearer) checkCertificate(r *http.Request, jwt *jwtverifier.Jwt) error {
+	source := b.Certificate
+	if source == nil {
+		source = mtls.TLS()
+	}
+	cert, err := source.Certificate(r)
+	if err != nil {
+		return errors.VerificationError(errors.ReasonBinding, err)
+	}
+	return mtls.CheckBinding(jwt.Claims, cert)
+}
+
+// challenge answers with status and a WWW-Authenticate header for scheme,
+// errorCode is left out of the challenge when empty
+func (b *Bearer) challenge(w http.ResponseWriter, status int, scheme, errorCode, description string, scopes []string) {
+	w.Header().Add("WWW-Authenticate", b.challengeValue(scheme, errorCode, description, scopes))
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (b *Bearer) challengeValue(scheme, errorCode, description string, scopes []string) string {
+	var params []string
+	if b.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", b.Realm))
+	}
+	if errorCode != "" {
+		params = append(params, fmt.Sprintf("error=%q", errorCode))
+		params = append(params, fmt.Sprintf("error_description=%q", description))
+	}
+	if len(scopes) > 0 {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(scopes, " ")))
+	}
+	if scheme == schemeDPoP && b.DPoP != nil {
+		algs := make([]string, len(b.DPoP.Algorithms))
+		for i, alg := range b.DPoP.Algorithms {
+			algs[i] = string(alg)
+		}
+		params = append(params, fmt.Sprintf("algs=%q", strings.Join(algs, " ")))
+	}
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(params, ", ")
+}
+
+// describe returns the error_description of a rejected token. It does not
+// repeat the verification error, which may reveal more than the client needs.
+func describe(reason errors.Reason) string {
+	switch reason {
+	case errors.ReasonMalformed:
+		return "The access token is malformed"
+	case errors.ReasonExpired:
+		return "The access token expired"
+	case errors.ReasonInactive:
+		return "The access token is not active"
+	case errors.ReasonTokenType:
+		return "The token is not an access token"
+	case errors.ReasonRevoked:
+		return "The access token was revoked"
+	case errors.ReasonIssuedAt:
+		return "The access token is not valid yet"
+	case errors.ReasonSignature:
+		return "The access token signature is invalid"
+	case errors.ReasonIssuer:
+		return "The access token was issued by another issuer"
+	case errors.ReasonAudience:
+		return "The access token is intended for another audience"
+	case errors.ReasonClientId:
+		return "The access token was issued to another client"
+	case errors.ReasonBinding:
+		return "The access token is not bound to the key of the client"
+	default:
+		return "The access token is invalid"
+	}
+}
+
+// describeProof returns the error_description of a rejected DPoP proof, like
+// describe it does not repeat the verification error.
+func describeProof(err error) string {
+	if stderrors.Is(err, replay.ErrReplayed) {
+		return "The DPoP proof was already used"
+	}
+	return "The DPoP proof is invalid"
+}
+
+// MissingScopes returns the scopes not granted to jwt by its `scp` or `scope`
+// claim
+func MissingScopes(jwt *jwtverifier.Jwt, scopes []string) []string {
+	granted := map[string]bool{}
+	switch scp := jwt.Claims["scp"].(type) {
+	case []interface{}:
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				granted[s] = true
+			}
+		}
+	case string:
+		for _, s := range strings.Fields(scp) {
+			granted[s] = true
+		}
+	}
+	if scope, ok := jwt.Claims["scope"].(string); ok {
+		for _, s := range strings.Fields(scope) {
+			granted[s] = true
+		}
+	}
+
+	var missing []string
+	for _, s := range scopes {
+		if !granted[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
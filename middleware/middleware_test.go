@@ -0,0 +1,135 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/extractors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testverifier"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = testissuer.Issuer
+
+// echoSubject answers with the subject of the verified token
+var echoSubject = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	jwt, ok := JwtFromContext(r.Context())
+	if !ok {
+		w.Write([]byte("anonymous"))
+		return
+	}
+	w.Write([]byte(jwt.Claims["sub"].(string)))
+})
+
+func serve(h http.Handler, authorization ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, a := range authorization {
+		req.Header.Add("Authorization", a)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBearerAuthenticatesRequests(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	h := (&Bearer{Verifier: jv, Realm: "api", Scopes: []string{"read"}}).Handler(echoSubject)
+
+	rec := serve(h, "bearer "+sign(testissuer.Claims("read", "write")))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user@example.com", rec.Body.String())
+
+	rec = serve(h)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer realm="api", scope="read"`, rec.Header().Get("WWW-Authenticate"))
+
+	expired := testissuer.Claims("read")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	rec = serve(h, "Bearer "+sign(expired))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer realm="api", error="invalid_token", error_description="The access token expired"`,
+		rec.Header().Get("WWW-Authenticate"))
+
+	rec = serve(h, "Bearer "+sign(testissuer.Claims("write")))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, `Bearer realm="api", error="insufficient_scope", error_description="The access token is missing the scopes: read", scope="read"`,
+		rec.Header().Get("WWW-Authenticate"))
+
+	for _, header := range []string{"Basic dXNlcjpwYXNz", "Bearer", "Bearer a b"} {
+		rec = serve(h, header)
+		require.Equal(t, http.StatusBadRequest, rec.Code, header)
+		require.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_request"`, header)
+	}
+	rec = serve(h, "Bearer a", "Bearer b")
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestBearerOptional(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	h := (&Bearer{Verifier: jv, Optional: true}).Handler(echoSubject)
+
+	rec := serve(h)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "anonymous", rec.Body.String())
+
+	rec = serve(h, "Bearer "+sign(testissuer.Claims()))
+	require.Equal(t, "user@example.com", rec.Body.String())
+
+	rec = serve(h, "Bearer not.a.token")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+}
+
+func TestBearerIssuerUnavailable(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	httpmock.RegisterResponder("GET", testIssuer+"/v1/keys", httpmock.NewStringResponder(500, ``))
+	h := (&Bearer{Verifier: jv}).Handler(echoSubject)
+
+	rec := serve(h, "Bearer "+sign(testissuer.Claims()))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Empty(t, rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestBearerUsesExtractor(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	h := (&Bearer{Verifier: jv, Extractor: extractors.Cookie("access_token")}).Handler(echoSubject)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: sign(testissuer.Claims())})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user@example.com", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
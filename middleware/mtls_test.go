@@ -0,0 +1,76 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testverifier"
+	"github.com/okta/okta-jwt-verifier-golang/v2/mtls"
+	"github.com/stretchr/testify/require"
+)
+
+func serveTLS(h http.Handler, token string, cert *x509.Certificate) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBearerChecksCertificateBinding(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	cert := testissuer.NewCertificate(t)
+	h := (&Bearer{Verifier: jv, Certificate: mtls.TLS()}).Handler(echoSubject)
+
+	bound := testissuer.Claims()
+	bound["cnf"] = map[string]interface{}{mtls.ConfirmationMethod: mtls.Thumbprint(cert)}
+	token := sign(bound)
+
+	rec := serveTLS(h, token, cert)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user@example.com", rec.Body.String())
+
+	for name, presented := range map[string]*x509.Certificate{"none": nil, "other": testissuer.NewCertificate(t)} {
+		rec = serveTLS(h, token, presented)
+		require.Equal(t, http.StatusUnauthorized, rec.Code, name)
+		require.Equal(t, `Bearer error="invalid_token", error_description="The access token is not bound to the key of the client"`,
+			rec.Header().Get("WWW-Authenticate"), name)
+	}
+
+	// unbound tokens do not need a certificate
+	rec = serveTLS(h, sign(testissuer.Claims()), nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// the certificate is taken from the TLS connection by default
+	h = (&Bearer{Verifier: jv}).Handler(echoSubject)
+	rec = serveTLS(h, token, cert)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serveTLS(h, token, nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
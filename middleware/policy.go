@@ -0,0 +1,291 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang/v2"
+)
+
+// Policy maps routes to the Requirement a verified token must satisfy to
+// access them.
+type Policy struct {
+	// Routes are tried in order, the first one matching the request applies
+	Routes []Route
+	// Default applies to requests matching no route, nil lets them through
+	Default Requirement
+}
+
+// Route matches requests by method and path.
+type Route struct {
+	// Method is matched exactly, an empty Method matches every method
+	Method string
+	// Pattern is matched with path.Match, so "*" matches a single segment. A
+	// Pattern ending with "/**" also matches every path below its prefix. A
+	// malformed Pattern matches every request and denies it, see
+	// Policy.Validate.
+	Pattern string
+	Require Requirement
+}
+
+// Requirement is a condition on a verified token.
+type Requirement interface {
+	// Check returns nil when jwt satisfies the requirement
+	Check(jwt *jwtverifier.Jwt) *Denial
+}
+
+// Denial explains why a token does not satisfy a Requirement. Scopes lists
+// the scopes that would satisfy it, if any, for the `scope` attribute of the
+// challenge.
+type Denial struct {
+	Description string
+	Scopes      []string
+}
+
+// Validate returns an error wrapping path.ErrBadPattern when the Pattern of a
+// route is malformed. Such a route denies every request it may apply to
+// rather than letting it fall through to the next routes or the Default.
+func (p *Policy) Validate() error {
+	for _, route := range p.Routes {
+		if strings.HasSuffix(route.Pattern, "/**") {
+			continue
+		}
+		if _, err := path.Match(route.Pattern, ""); err != nil {
+			return fmt.Errorf("the route pattern %q is invalid: %w", route.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// Check returns the Denial of the requirement that applies to r, if any.
+func (p *Policy) Check(r *http.Request, jwt *jwtverifier.Jwt) *Denial {
+	return check(p.Requirement(r), jwt)
+}
+
+// Requirement returns the requirement that applies to r, nil when none does.
+func (p *Policy) Requirement(r *http.Request) Requirement {
+	requestPath := cleanPath(r.URL.Path)
+	for _, route := range p.Routes {
+		matched, err := route.matches(r.Method, requestPath)
+		if err != nil {
+			return denyAll
+		}
+		if matched {
+			return route.Require
+		}
+	}
+	return p.Default
+}
+
+// denyAll is the requirement of the routes with a malformed Pattern, and
+// stands for the nil requirements given to AllOf and AnyOf. No token
+// satisfies it.
+var denyAll = RequirementFunc(func(*jwtverifier.Jwt) *Denial {
+	return &Denial{Description: "The route cannot be authorized"}
+})
+
+// cleanPath resolves the empty, "." and ".." segments of a request path so
+// that "//admin/x" or "/admin/./x" match the routes of "/admin/x". A trailing
+// slash is kept.
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func check(req Requirement, jwt *jwtverifier.Jwt) *Denial {
+	if req == nil {
+		return nil
+	}
+	return req.Check(jwt)
+}
+
+func (route Route) matches(method, requestPath string) (bool, error) {
+	if route.Method != "" && route.Method != method {
+		return false, nil
+	}
+	if strings.HasSuffix(route.Pattern, "/**") {
+		prefix := strings.TrimSuffix(route.Pattern, "/**")
+		return requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/"), nil
+	}
+	return path.Match(route.Pattern, requestPath)
+}
+
+// RequirementFunc adapts a function to a Requirement.
+type RequirementFunc func(jwt *jwtverifier.Jwt) *Denial
+
+func (f RequirementFunc) Check(jwt *jwtverifier.Jwt) *Denial {
+	return f(jwt)
+}
+
+// AllOf is satisfied when every requirement is. A nil requirement is never
+// satisfied.
+func AllOf(reqs ...Requirement) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		for _, req := range reqs {
+			if req == nil {
+				req = denyAll
+			}
+			if denial := req.Check(jwt); denial != nil {
+				return denial
+			}
+		}
+		return nil
+	})
+}
+
+// AnyOf is satisfied when at least one requirement is. A nil requirement is
+// never satisfied.
+func AnyOf(reqs ...Requirement) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		combined := &Denial{}
+		var descriptions []string
+		for _, req := range reqs {
+			if req == nil {
+				continue
+			}
+			denial := req.Check(jwt)
+			if denial == nil {
+				return nil
+			}
+			descriptions = append(descriptions, denial.Description)
+			combined.Scopes = appendMissing(combined.Scopes, denial.Scopes...)
+		}
+		if len(descriptions) == 0 {
+			return denyAll.Check(jwt)
+		}
+		combined.Description = strings.Join(descriptions, ", or ")
+		return combined
+	})
+}
+
+// AllScopes requires every scope to be granted to the token.
+func AllScopes(scopes ...string) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		if missing := MissingScopes(jwt, scopes); len(missing) > 0 {
+			return &Denial{
+				Description: fmt.Sprintf("The access token is missing the scopes: %s", strings.Join(missing, " ")),
+				Scopes:      scopes,
+			}
+		}
+		return nil
+	})
+}
+
+// AnyScope requires at least one of scopes to be granted to the token.
+func AnyScope(scopes ...string) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		if len(MissingScopes(jwt, scopes)) < len(scopes) {
+			return nil
+		}
+		return &Denial{
+			Description: fmt.Sprintf("The access token needs one of the scopes: %s", strings.Join(scopes, " ")),
+			Scopes:      scopes,
+		}
+	})
+}
+
+// AllGroups requires the `groups` claim to contain every group. Like AnyGroup
+// its denial does not name the groups, which are internal to the server.
+func AllGroups(groups ...string) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		member := stringSet(jwt.Claims["groups"])
+		for _, g := range groups {
+			if !member[g] {
+				return &Denial{Description: "The access token is not in the required groups"}
+			}
+		}
+		return nil
+	})
+}
+
+// AnyGroup requires the `groups` claim to contain at least one group.
+func AnyGroup(groups ...string) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		member := stringSet(jwt.Claims["groups"])
+		for _, g := range groups {
+			if member[g] {
+				return nil
+			}
+		}
+		return &Denial{Description: "The access token is in none of the allowed groups"}
+	})
+}
+
+// ClientId requires the token to be issued to one of clientIds.
+func ClientId(clientIds ...string) Requirement {
+	return Claim("cid", clientIds...)
+}
+
+// Claim requires the claim name to be one of values, or to contain one of
+// them when the claim is a list.
+func Claim(name string, values ...string) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		present := stringSet(jwt.Claims[name])
+		for _, v := range values {
+			if present[v] {
+				return nil
+			}
+		}
+		return &Denial{Description: fmt.Sprintf("The access token claim %s is not allowed", name)}
+	})
+}
+
+// Predicate requires f to return true, description explains the denial.
+func Predicate(description string, f func(jwt *jwtverifier.Jwt) bool) Requirement {
+	return RequirementFunc(func(jwt *jwtverifier.Jwt) *Denial {
+		if f(jwt) {
+			return nil
+		}
+		return &Denial{Description: description}
+	})
+}
+
+// stringSet returns the strings of a claim, which may be a string or a list
+func stringSet(claim interface{}) map[string]bool {
+	set := map[string]bool{}
+	switch v := claim.(type) {
+	case string:
+		set[v] = true
+	case []interface{}:
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				set[s] = true
+			}
+		}
+	}
+	return set
+}
+
+func appendMissing(values []string, more ...string) []string {
+	for _, m := range more {
+		found := false
+		for _, v := range values {
+			found = found || v == m
+		}
+		if !found {
+			values = append(values, m)
+		}
+	}
+	return values
+}
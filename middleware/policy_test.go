@@ -0,0 +1,182 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	jwtverifier "github.com/okta/okta-jwt-verifier-golang/v2"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testverifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyRoutes(t *testing.T) {
+	policy := &Policy{
+		Routes: []Route{
+			{Method: http.MethodDelete, Pattern: "/orders/*", Require: AllOf(AllScopes("orders:write"), AnyGroup("admins", "support"))},
+			{Pattern: "/orders/**", Require: AnyOf(AnyScope("orders:read", "orders:write"), ClientId("batch"))},
+			{Pattern: "/reports/*/export", Require: Predicate("Exports need a verified email", func(jwt *jwtverifier.Jwt) bool {
+				verified, _ := jwt.Claims["email_verified"].(bool)
+				return verified
+			})},
+		},
+		Default: Claim("tier", "gold", "platinum"),
+	}
+	check := func(method, path string, claims map[string]interface{}) *Denial {
+		return policy.Check(httptest.NewRequest(method, path, nil), &jwtverifier.Jwt{Claims: claims})
+	}
+
+	reader := map[string]interface{}{"scp": []interface{}{"orders:read"}}
+	require.Nil(t, check(http.MethodGet, "/orders", reader))
+	require.Nil(t, check(http.MethodGet, "/orders/42/items", reader))
+	require.Nil(t, check(http.MethodGet, "/orders/42", map[string]interface{}{"cid": "batch"}))
+
+	denial := check(http.MethodGet, "/orders/42", map[string]interface{}{"cid": "web"})
+	require.NotNil(t, denial)
+	require.Equal(t, []string{"orders:read", "orders:write"}, denial.Scopes)
+	require.Contains(t, denial.Description, ", or ")
+
+	denial = check(http.MethodDelete, "/orders/42", map[string]interface{}{"scp": "orders:write", "groups": []interface{}{"everyone"}})
+	require.NotNil(t, denial)
+	require.Empty(t, denial.Scopes)
+	require.Nil(t, check(http.MethodDelete, "/orders/42", map[string]interface{}{"scp": "orders:write", "groups": []interface{}{"support"}}))
+
+	require.NotNil(t, check(http.MethodGet, "/reports/2024/export", map[string]interface{}{}))
+	require.Nil(t, check(http.MethodGet, "/reports/2024/export", map[string]interface{}{"email_verified": true}))
+
+	require.NotNil(t, check(http.MethodGet, "/profile", map[string]interface{}{"tier": "silver"}))
+	require.Nil(t, check(http.MethodGet, "/profile", map[string]interface{}{"tier": "gold"}))
+}
+
+func TestPolicyBadPatternDenies(t *testing.T) {
+	policy := &Policy{Routes: []Route{
+		{Method: http.MethodPost, Pattern: "/admin/[", Require: AllScopes("admin")},
+		{Pattern: "/public/**"},
+	}}
+	require.ErrorIs(t, policy.Validate(), path.ErrBadPattern)
+	require.NoError(t, (&Policy{Routes: []Route{{Pattern: "/orders/*"}, {Pattern: "/a/[/**"}}}).Validate())
+
+	check := func(method, target string) *Denial {
+		jwt := &jwtverifier.Jwt{Claims: map[string]interface{}{"scp": "admin"}}
+		return policy.Check(httptest.NewRequest(method, target, nil), jwt)
+	}
+	require.NotNil(t, check(http.MethodPost, "/admin/users"))
+	require.NotNil(t, check(http.MethodPost, "/public/x"))
+	require.Nil(t, check(http.MethodGet, "/public/x"))
+}
+
+func TestAllGroups(t *testing.T) {
+	jwt := &jwtverifier.Jwt{Claims: map[string]interface{}{"groups": []interface{}{"a", "b"}}}
+	require.Nil(t, AllGroups("a", "b").Check(jwt))
+	denial := AllGroups("a", "payroll-admins").Check(jwt)
+	require.NotNil(t, denial)
+	require.NotContains(t, denial.Description, "payroll-admins")
+	require.NotContains(t, AnyGroup("admins").Check(jwt).Description, "admins")
+}
+
+func TestCombinedRequirementsDenyNil(t *testing.T) {
+	jwt := &jwtverifier.Jwt{Claims: map[string]interface{}{"scp": "read"}}
+	require.NotNil(t, AllOf(AllScopes("read"), nil).Check(jwt))
+	require.NotNil(t, AnyOf(nil).Check(jwt))
+	require.NotNil(t, AnyOf(nil, AllScopes("write")).Check(jwt))
+	require.Nil(t, AnyOf(nil, AllScopes("read")).Check(jwt))
+}
+
+func TestBearerAppliesPolicy(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	h := (&Bearer{
+		Verifier: jv,
+		Policy: &Policy{Routes: []Route{
+			{Pattern: "/admin/**", Require: AllScopes("admin")},
+		}},
+	}).Handler(echoSubject)
+
+	serveAt := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, serveAt("/public", sign(testissuer.Claims())).Code)
+	require.Equal(t, http.StatusOK, serveAt("/admin/users", sign(testissuer.Claims("admin"))).Code)
+
+	rec := serveAt("/admin/users", sign(testissuer.Claims("read")))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, `Bearer error="insufficient_scope", error_description="The access token is missing the scopes: admin", scope="admin"`,
+		rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestPolicyMatchesCleanedPaths(t *testing.T) {
+	policy := &Policy{Routes: []Route{
+		{Pattern: "/admin/**", Require: AllScopes("admin")},
+		{Pattern: "/files/", Require: AllScopes("files")},
+	}}
+	jwt := &jwtverifier.Jwt{Claims: map[string]interface{}{}}
+
+	for _, p := range []string{"/admin/x", "//admin/x", "/admin/./x", "/public/../admin/x", "/admin", "/files/"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = p
+		require.NotNil(t, policy.Check(req, jwt), p)
+	}
+	require.Nil(t, policy.Check(httptest.NewRequest(http.MethodGet, "/administrator", nil), jwt))
+}
+
+func TestOptionalBearerAppliesPolicy(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	jv, sign := testverifier.New(t)
+	bearer := &Bearer{
+		Verifier: jv,
+		Optional: true,
+		Policy: &Policy{Routes: []Route{
+			{Pattern: "/admin/**", Require: AllScopes("admin")},
+		}},
+	}
+	h := bearer.Handler(echoSubject)
+
+	serveAt := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = path
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, serveAt("/public", "").Code)
+	for _, p := range []string{"/admin/users", "//admin/users", "/admin/./users"} {
+		rec := serveAt(p, "")
+		require.Equal(t, http.StatusUnauthorized, rec.Code, p)
+		require.Equal(t, `Bearer`, rec.Header().Get("WWW-Authenticate"))
+	}
+	require.Equal(t, http.StatusOK, serveAt("/admin/users", sign(testissuer.Claims("admin"))).Code)
+
+	bearer.Policy.Default = AnyScope("read")
+	h = bearer.Handler(echoSubject)
+	require.Equal(t, http.StatusUnauthorized, serveAt("/public", "").Code)
+}
@@ -0,0 +1,145 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+)
+
+// ConfirmationMethod is the member of the `cnf` claim holding the
+// thumbprint of the certificate a token is bound to (RFC 8705 section 3.1)
+const ConfirmationMethod = "x5t#S256"
+
+// ErrNoCertificate is wrapped by the errors of certificate-bound tokens sent
+// without a client certificate
+var ErrNoCertificate = stderrors.New("the client presented no certificate")
+
+// Source finds the client certificate of a request. It returns nil when the
+// request has none.
+type Source interface {
+	Certificate(r *http.Request) (*x509.Certificate, error)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(r *http.Request) (*x509.Certificate, error)
+
+func (f SourceFunc) Certificate(r *http.Request) (*x509.Certificate, error) {
+	return f(r)
+}
+
+// TLS finds the certificate the client presented in the TLS handshake of the
+// request.
+func TLS() Source {
+	return SourceFunc(func(r *http.Request) (*x509.Certificate, error) {
+		return FromConnectionState(r.TLS), nil
+	})
+}
+
+// Header finds the certificate a TLS-terminating proxy forwards in the header
+// name, either as URL-escaped PEM, such as nginx's
+// `$ssl_client_escaped_cert`, or as base64 DER. The header must only be
+// trusted when the proxy overwrites it on every request.
+func Header(name string) Source {
+	return SourceFunc(func(r *http.Request) (*x509.Certificate, error) {
+		values := r.Header.Values(name)
+		if len(values) == 0 || values[0] == "" {
+			return nil, nil
+		}
+		if len(values) > 1 {
+			return nil, fmt.Errorf("the request has more than one %s header", name)
+		}
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("the %s header is not URL-escaped: %w", name, err)
+		}
+		var der []byte
+		if block, _ := pem.Decode([]byte(value)); block != nil {
+			der = block.Bytes
+		} else if der, err = base64.StdEncoding.DecodeString(strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("the %s header is neither PEM nor base64 DER: %w", name, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("the %s header is not a valid certificate: %w", name, err)
+		}
+		return cert, nil
+	})
+}
+
+// FromConnectionState returns the client certificate of a TLS connection, or
+// nil when it has none.
+func FromConnectionState(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// Thumbprint returns the base64url encoded SHA-256 thumbprint of cert, found
+// in the `cnf` claim of the tokens bound to it.
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Bound reports whether an access token is bound to a certificate by its
+// `cnf` claim.
+func Bound(claims map[string]interface{}) bool {
+	return confirmation(claims) != ""
+}
+
+// CheckBinding verifies that the access token with claims is bound to cert.
+// cert may be nil when the client presented none.
+func CheckBinding(claims map[string]interface{}, cert *x509.Certificate) error {
+	thumbprint := confirmation(claims)
+	if thumbprint == "" {
+		return errors.VerificationError(errors.ReasonBinding,
+			fmt.Errorf("the access token is not bound to a certificate"))
+	}
+	if cert == nil {
+		return errors.VerificationError(errors.ReasonBinding,
+			fmt.Errorf("the access token is bound to a certificate: %w", ErrNoCertificate))
+	}
+	if thumbprint != Thumbprint(cert) {
+		return errors.VerificationError(errors.ReasonBinding,
+			fmt.Errorf("the access token is bound to another certificate"))
+	}
+	return nil
+}
+
+// CheckConnection verifies that the access token with claims is bound to the
+// client certificate of a TLS connection.
+func CheckConnection(claims map[string]interface{}, state *tls.ConnectionState) error {
+	return CheckBinding(claims, FromConnectionState(state))
+}
+
+func confirmation(claims map[string]interface{}) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	thumbprint, _ := cnf[ConfirmationMethod].(string)
+	return thumbprint
+}
@@ -0,0 +1,82 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/stretchr/testify/require"
+)
+
+func boundTo(cert *x509.Certificate) map[string]interface{} {
+	return map[string]interface{}{"cnf": map[string]interface{}{ConfirmationMethod: Thumbprint(cert)}}
+}
+
+func TestCheckBinding(t *testing.T) {
+	cert, other := testissuer.NewCertificate(t), testissuer.NewCertificate(t)
+	require.True(t, Bound(boundTo(cert)))
+	require.False(t, Bound(map[string]interface{}{}))
+
+	require.NoError(t, CheckBinding(boundTo(cert), cert))
+	require.NoError(t, CheckConnection(boundTo(cert), &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}))
+
+	err := CheckBinding(boundTo(cert), other)
+	require.Equal(t, errors.ReasonBinding, errors.ReasonOf(err))
+	err = CheckConnection(boundTo(cert), &tls.ConnectionState{})
+	require.Equal(t, errors.ReasonBinding, errors.ReasonOf(err))
+	require.ErrorIs(t, err, ErrNoCertificate)
+	err = CheckBinding(map[string]interface{}{}, cert)
+	require.Equal(t, errors.ReasonBinding, errors.ReasonOf(err))
+}
+
+func TestSources(t *testing.T) {
+	cert := testissuer.NewCertificate(t)
+
+	r := httptest.NewRequest("GET", "https://api.example.com/", nil)
+	found, err := TLS().Certificate(r)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	r.TLS.PeerCertificates = []*x509.Certificate{cert}
+	found, err = TLS().Certificate(r)
+	require.NoError(t, err)
+	require.Equal(t, cert, found)
+
+	escapedPem := url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+	for _, value := range []string{escapedPem, base64.StdEncoding.EncodeToString(cert.Raw)} {
+		r = httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Client-Cert", value)
+		found, err = Header("X-Client-Cert").Certificate(r)
+		require.NoError(t, err)
+		require.Equal(t, cert.Raw, found.Raw)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	found, err = Header("X-Client-Cert").Certificate(r)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	r.Header.Set("X-Client-Cert", "not a certificate")
+	_, err = Header("X-Client-Cert").Certificate(r)
+	require.Error(t, err)
+}
@@ -0,0 +1,158 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package replay
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries bounds the number of ids a Memory store keeps
+const DefaultMaxEntries = 100000
+
+// ErrReplayed is returned by Check for a token that was already used
+var ErrReplayed = errors.New("the token was already used")
+
+// Store remembers the tokens that were used, to accept each of them once.
+// Implementations shared by several processes must record ids atomically.
+type Store interface {
+	// Use records id until expiresAt and reports whether it is its first use
+	Use(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
+
+// Releaser is implemented by stores that can forget a recorded id, so that a
+// token whose processing failed after it was recorded can be retried.
+type Releaser interface {
+	Release(ctx context.Context, id string) error
+}
+
+// Id returns the replay id of a token: its issuer and `jti`, or a hash of
+// the token when it has no `jti`.
+func Id(token string, claims map[string]interface{}) string {
+	iss, _ := claims["iss"].(string)
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return iss + "#" + jti
+	}
+	sum := sha256.Sum256([]byte(token))
+	return iss + "#sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Check records the token in s until its `exp` plus leeway, and returns
+// ErrReplayed when it was already used.
+func Check(ctx context.Context, s Store, token string, claims map[string]interface{}, leeway time.Duration) error {
+	exp, _ := claims["exp"].(float64)
+	first, err := s.Use(ctx, Id(token, claims), time.Unix(int64(exp), 0).Add(leeway))
+	if err != nil {
+		return err
+	}
+	if !first {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// Memory is a Store kept in memory. Ids are dropped once they expire, and
+// once MaxEntries unexpired ids are kept further tokens are refused rather
+// than risk accepting a replay.
+type Memory struct {
+	// MaxEntries defaults to DefaultMaxEntries
+	MaxEntries int
+
+	mutex    sync.Mutex
+	expiries map[string]time.Time
+	queue    expiryQueue
+}
+
+func (m *Memory) Use(_ context.Context, id string, expiresAt time.Time) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.expiries == nil {
+		m.expiries = map[string]time.Time{}
+	}
+
+	now := time.Now()
+	for len(m.queue) > 0 && !m.queue[0].expiresAt.After(now) {
+		expired := heap.Pop(&m.queue).(expiry)
+		if m.expiries[expired.id].Equal(expired.expiresAt) {
+			delete(m.expiries, expired.id)
+		}
+	}
+
+	if _, used := m.expiries[id]; used {
+		return false, nil
+	}
+	if !expiresAt.After(now) {
+		// the token is expired and will be rejected anyway
+		return true, nil
+	}
+	max := m.MaxEntries
+	if max <= 0 {
+		max = DefaultMaxEntries
+	}
+	if len(m.expiries) >= max {
+		return false, fmt.Errorf("the replay store is full with %d unexpired tokens", len(m.expiries))
+	}
+	m.expiries[id] = expiresAt
+	heap.Push(&m.queue, expiry{id: id, expiresAt: expiresAt})
+	return true, nil
+}
+
+// Release forgets id, it is accepted again by the next Use.
+func (m *Memory) Release(_ context.Context, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.expiries, id)
+	return nil
+}
+
+// Len returns the number of ids kept.
+func (m *Memory) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.expiries)
+}
+
+type expiry struct {
+	id        string
+	expiresAt time.Time
+}
+
+// expiryQueue is a heap of ids by expiry
+type expiryQueue []expiry
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiry)) }
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Memory implements the Store and Releaser interfaces
+var (
+	_ Store    = (*Memory)(nil)
+	_ Releaser = (*Memory)(nil)
+)
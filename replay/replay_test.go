@@ -0,0 +1,83 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package replay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryUsesIdsOnce(t *testing.T) {
+	m := &Memory{MaxEntries: 2}
+	ctx := context.Background()
+
+	first, err := m.Use(ctx, "a", time.Now().Add(20*time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, first)
+	first, err = m.Use(ctx, "a", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, first)
+
+	first, err = m.Use(ctx, "b", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, first)
+	_, err = m.Use(ctx, "c", time.Now().Add(time.Minute))
+	require.Error(t, err)
+
+	// expired ids make room
+	time.Sleep(30 * time.Millisecond)
+	first, err = m.Use(ctx, "c", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, first)
+	require.Equal(t, 2, m.Len())
+
+	// released ids are accepted again
+	require.NoError(t, m.Release(ctx, "c"))
+	first, err = m.Use(ctx, "c", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, first)
+
+	// expired tokens are not remembered
+	m = &Memory{}
+	first, _ = m.Use(ctx, "d", time.Now().Add(-time.Second))
+	require.True(t, first)
+	require.Equal(t, 0, m.Len())
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	m := &Memory{}
+	exp := float64(time.Now().Add(-time.Second).Unix())
+
+	// the leeway keeps a token that just expired
+	claims := map[string]interface{}{"iss": "https://issuer", "jti": "a", "exp": exp}
+	require.NoError(t, Check(ctx, m, "token-a", claims, time.Minute))
+	require.Equal(t, ErrReplayed, Check(ctx, m, "another-token", claims, time.Minute))
+
+	noJti := map[string]interface{}{"iss": "https://issuer", "exp": exp}
+	require.NoError(t, Check(ctx, m, "token-b", noJti, time.Minute))
+	require.Equal(t, ErrReplayed, Check(ctx, m, "token-b", noJti, time.Minute))
+	require.NoError(t, Check(ctx, m, "token-c", noJti, time.Minute))
+}
+
+func TestId(t *testing.T) {
+	require.Equal(t, "https://issuer#a", Id("token", map[string]interface{}{"iss": "https://issuer", "jti": "a"}))
+	require.NotEqual(t, Id("token-1", map[string]interface{}{}), Id("token-2", map[string]interface{}{}))
+}
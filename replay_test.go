@@ -0,0 +1,88 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/replay"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayedIdTokensAreRejected(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	store := &replay.Memory{}
+	jvs := JwtVerifier{
+		Issuer:           testIssuer,
+		ClaimsToValidate: map[string]string{"aud": "api://default", "nonce": "n-1"},
+		Replay:           store,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["nonce"] = "n-1"
+	token := key.Sign(t, claims)
+	_, err = jv.VerifyIdToken(token)
+	require.NoError(t, err)
+	_, err = jv.VerifyIdToken(token)
+	require.Equal(t, errors.ReasonReplayed, errors.ReasonOf(err))
+
+	// invalid tokens are not remembered
+	claims["nonce"] = "other"
+	_, err = jv.VerifyIdToken(key.Sign(t, claims))
+	require.Equal(t, errors.ReasonNonce, errors.ReasonOf(err))
+	require.Equal(t, 1, store.Len())
+
+	// access tokens are reused
+	access := key.Sign(t, validClaims())
+	_, err = jv.VerifyAccessToken(access)
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(access)
+	require.NoError(t, err)
+}
+
+func TestFullReplayStoreIsUnavailable(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	jvs := JwtVerifier{
+		Issuer:           testIssuer,
+		ClaimsToValidate: map[string]string{"aud": "api://default", "nonce": "n-1"},
+		Replay:           &replay.Memory{MaxEntries: 1},
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["nonce"] = "n-1"
+	claims["jti"] = "a"
+	_, err = jv.VerifyIdToken(key.Sign(t, claims))
+	require.NoError(t, err)
+	claims["jti"] = "b"
+	_, err = jv.VerifyIdToken(key.Sign(t, claims))
+	require.Equal(t, errors.ReasonReplayUnavailable, errors.ReasonOf(err))
+}
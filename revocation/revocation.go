@@ -0,0 +1,171 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Kind is the claim a revocation applies to.
+type Kind string
+
+const (
+	// KindJti revokes a single token
+	KindJti Kind = "jti"
+	// KindSubject revokes every token of a user issued before the revocation
+	KindSubject Kind = "sub"
+	// KindSession revokes every token of a session issued before the
+	// revocation
+	KindSession Kind = "sid"
+)
+
+// Kinds are the claims checked by the verifier, in order
+var Kinds = []Kind{KindJti, KindSubject, KindSession}
+
+// Store holds revoked claim values. A token is revoked when the value of one
+// of its claims was revoked at or after the time the token was issued.
+type Store interface {
+	// RevokedAt returns when value was revoked as a kind, and false when it
+	// is not revoked
+	RevokedAt(ctx context.Context, kind Kind, value string) (time.Time, bool, error)
+}
+
+// Revocation is a revoked claim value. It is forgotten after ExpiresAt,
+// which should be no earlier than the expiry of the last token it revokes.
+type Revocation struct {
+	Kind      Kind      `json:"kind"`
+	Value     string    `json:"value"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Memory is a Store kept in memory, revocations are dropped once they expire.
+// The zero value is ready to use.
+type Memory struct {
+	// DefaultTTL is how long revocations without ExpiresAt are kept, it
+	// defaults to 24 hours, the longest lifetime of an Okta access token
+	DefaultTTL time.Duration
+	// Cleanup is the interval at which expired revocations are dropped, it
+	// defaults to 10 minutes
+	Cleanup time.Duration
+	// MaxBodyBytes bounds the body accepted by Handler, it defaults to 1 MiB
+	MaxBodyBytes int64
+
+	once    sync.Once
+	revoked *cache.Cache
+}
+
+func (m *Memory) New() *Memory {
+	m.init()
+	return m
+}
+
+func (m *Memory) init() {
+	m.once.Do(func() {
+		if m.DefaultTTL == 0 {
+			m.DefaultTTL = 24 * time.Hour
+		}
+		if m.Cleanup == 0 {
+			m.Cleanup = 10 * time.Minute
+		}
+		if m.MaxBodyBytes == 0 {
+			m.MaxBodyBytes = 1 << 20
+		}
+		m.revoked = cache.New(m.DefaultTTL, m.Cleanup)
+	})
+}
+
+// Revoke records revocations, RevokedAt defaults to now.
+func (m *Memory) Revoke(revocations ...Revocation) {
+	m.init()
+	now := time.Now()
+	for _, r := range revocations {
+		if r.RevokedAt.IsZero() {
+			r.RevokedAt = now
+		}
+		ttl := cache.DefaultExpiration
+		if !r.ExpiresAt.IsZero() {
+			ttl = r.ExpiresAt.Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+		m.revoked.Set(key(r.Kind, r.Value), r.RevokedAt, ttl)
+	}
+}
+
+// Restore forgets the revocation of value as a kind.
+func (m *Memory) Restore(kind Kind, value string) {
+	m.init()
+	m.revoked.Delete(key(kind, value))
+}
+
+func (m *Memory) RevokedAt(_ context.Context, kind Kind, value string) (time.Time, bool, error) {
+	m.init()
+	revokedAt, found := m.revoked.Get(key(kind, value))
+	if !found {
+		return time.Time{}, false, nil
+	}
+	return revokedAt.(time.Time), true, nil
+}
+
+// Handler accepts revocations pushed as a JSON array of Revocation in the
+// body of a POST request. It does not authenticate its callers, it must be
+// served behind an authentication such as middleware.Bearer.
+func (m *Memory) Handler() http.Handler {
+	m.init()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		var revocations []Revocation
+		body := http.MaxBytesReader(w, r.Body, m.MaxBodyBytes)
+		if err := json.NewDecoder(body).Decode(&revocations); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "the body must be a JSON array of revocations", http.StatusBadRequest)
+			return
+		}
+		for _, rev := range revocations {
+			if rev.Value == "" || (rev.Kind != KindJti && rev.Kind != KindSubject && rev.Kind != KindSession) {
+				http.Error(w, "every revocation needs a value and a kind of jti, sub or sid", http.StatusBadRequest)
+				return
+			}
+		}
+		m.Revoke(revocations...)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func key(kind Kind, value string) string {
+	return string(kind) + ":" + value
+}
+
+// Memory implements the Store interface
+var _ Store = (*Memory)(nil)
@@ -0,0 +1,104 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package revocation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRevocations(t *testing.T) {
+	m := (&Memory{}).New()
+	revokedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	m.Revoke(
+		Revocation{Kind: KindJti, Value: "a", RevokedAt: revokedAt},
+		Revocation{Kind: KindSubject, Value: "user", ExpiresAt: time.Now().Add(20 * time.Millisecond)},
+		Revocation{Kind: KindSession, Value: "expired", ExpiresAt: time.Now().Add(-time.Second)},
+	)
+
+	at, revoked, err := m.RevokedAt(context.Background(), KindJti, "a")
+	require.NoError(t, err)
+	require.True(t, revoked)
+	require.Equal(t, revokedAt, at)
+
+	_, revoked, _ = m.RevokedAt(context.Background(), KindSubject, "a")
+	require.False(t, revoked)
+	_, revoked, _ = m.RevokedAt(context.Background(), KindSession, "expired")
+	require.False(t, revoked)
+
+	_, revoked, _ = m.RevokedAt(context.Background(), KindSubject, "user")
+	require.True(t, revoked)
+	time.Sleep(30 * time.Millisecond)
+	_, revoked, _ = m.RevokedAt(context.Background(), KindSubject, "user")
+	require.False(t, revoked)
+
+	m.Restore(KindJti, "a")
+	_, revoked, _ = m.RevokedAt(context.Background(), KindJti, "a")
+	require.False(t, revoked)
+}
+
+func TestMemoryHandler(t *testing.T) {
+	m := (&Memory{}).New()
+	h := m.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/revocations",
+		strings.NewReader(`[{"kind":"jti","value":"a"},{"kind":"sid","value":"s","expires_at":"2999-01-01T00:00:00Z"}]`)))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	_, revoked, _ := m.RevokedAt(context.Background(), KindJti, "a")
+	require.True(t, revoked)
+	_, revoked, _ = m.RevokedAt(context.Background(), KindSession, "s")
+	require.True(t, revoked)
+
+	for _, body := range []string{`{}`, `[{"kind":"email","value":"a"}]`, `[{"kind":"jti"}]`} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/revocations", strings.NewReader(body)))
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/revocations", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestZeroMemory(t *testing.T) {
+	var m Memory
+	_, revoked, err := m.RevokedAt(context.Background(), KindJti, "a")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	m.Revoke(Revocation{Kind: KindJti, Value: "a"})
+	_, revoked, _ = m.RevokedAt(context.Background(), KindJti, "a")
+	require.True(t, revoked)
+	require.Equal(t, 24*time.Hour, m.DefaultTTL)
+}
+
+func TestMemoryHandlerBoundsBody(t *testing.T) {
+	m := &Memory{MaxBodyBytes: 64}
+	body := `[{"kind":"jti","value":"` + strings.Repeat("a", 100) + `"}]`
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/revocations", strings.NewReader(body)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	_, revoked, _ := m.RevokedAt(context.Background(), KindJti, strings.Repeat("a", 100))
+	require.False(t, revoked)
+}
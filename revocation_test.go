@@ -0,0 +1,125 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/revocation"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokedTokensAreRejected(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	store := (&revocation.Memory{}).New()
+	jvs := JwtVerifier{Issuer: testIssuer, Revocation: store}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["jti"] = "token-1"
+	claims["iat"] = time.Now().Add(-time.Minute).Unix()
+	token := key.Sign(t, claims)
+	_, err = jv.VerifyAccessToken(token)
+	require.NoError(t, err)
+
+	store.Revoke(revocation.Revocation{Kind: revocation.KindJti, Value: "token-1"})
+	_, err = jv.VerifyAccessToken(token)
+	require.Equal(t, errors.ReasonRevoked, errors.ReasonOf(err))
+
+	// revoking a subject only rejects the tokens issued before
+	store.Revoke(revocation.Revocation{Kind: revocation.KindSubject, Value: "user@example.com"})
+	_, err = jv.VerifyAccessToken(key.Sign(t, validClaims()))
+	require.Equal(t, errors.ReasonRevoked, errors.ReasonOf(err))
+	later := validClaims()
+	later["iat"] = time.Now().Add(time.Minute).Unix()
+	_, err = jv.VerifyAccessToken(key.Sign(t, later))
+	require.NoError(t, err)
+}
+
+func TestLongLivedTokensAreConfirmed(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+	old := validClaims()
+	old["iat"] = time.Now().Add(-time.Hour).Unix()
+	oldToken, freshToken := key.Sign(t, old), key.Sign(t, validClaims())
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{oldToken: introspectedClaims()}, &requests)
+
+	jvs := JwtVerifier{
+		Issuer:          testIssuer,
+		Introspection:   &Introspector{ClientId: "client", ClientSecret: "s3cr3t"},
+		ConfirmInterval: 10 * time.Minute,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken(freshToken)
+	require.NoError(t, err)
+	require.Empty(t, requests)
+
+	_, err = jv.VerifyAccessToken(oldToken)
+	require.NoError(t, err)
+	_, err = jv.VerifyAccessToken(oldToken)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+
+	old["jti"] = "revoked"
+	_, err = jv.VerifyAccessToken(key.Sign(t, old))
+	require.Equal(t, errors.ReasonInactive, errors.ReasonOf(err))
+}
+
+func TestRevokedTokensAreRejectedAfterIntrospection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	testissuer.Register(t, testissuer.NewKey(t, "kid-1"))
+	claims := introspectedClaims()
+	claims["jti"] = "opaque-1"
+	claims["iat"] = time.Now().Add(-time.Minute).Unix()
+	var requests []*http.Request
+	registerIntrospection(t, map[string]map[string]interface{}{"opaque": claims}, &requests)
+
+	store := (&revocation.Memory{}).New()
+	jvs := JwtVerifier{
+		Issuer:        testIssuer,
+		Introspection: &Introspector{ClientId: "client", ClientSecret: "s3cr3t"},
+		Revocation:    store,
+	}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	_, err = jv.VerifyAccessToken("opaque")
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+
+	// the cached introspection result is checked again
+	store.Revoke(revocation.Revocation{Kind: revocation.KindJti, Value: "opaque-1"})
+	_, err = jv.VerifyAccessToken("opaque")
+	require.Equal(t, errors.ReasonRevoked, errors.ReasonOf(err))
+	require.Len(t, requests, 1)
+}
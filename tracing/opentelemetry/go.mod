@@ -0,0 +1,23 @@
+module github.com/okta/okta-jwt-verifier-golang/v2/tracing/opentelemetry
+
+go 1.19
+
+require (
+	github.com/okta/okta-jwt-verifier-golang/v2 v2.2.0
+	github.com/stretchr/testify v1.10.0
+	go.opentelemetry.io/otel v1.16.0
+	go.opentelemetry.io/otel/sdk v1.16.0
+	go.opentelemetry.io/otel/trace v1.16.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.opentelemetry.io/otel/metric v1.16.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/okta/okta-jwt-verifier-golang/v2 => ../..
@@ -0,0 +1,85 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package opentelemetry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the spans of the verifier
+const InstrumentationName = "github.com/okta/okta-jwt-verifier-golang/v2"
+
+// Tracer starts OpenTelemetry spans for the verifier.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer using provider, or the global TracerProvider
+// when provider is nil.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: provider.Tracer(InstrumentationName)}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, attributes ...tracing.Attribute) (context.Context, tracing.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(toKeyValues(attributes)...))
+	return ctx, &Span{span: span}
+}
+
+// Span wraps an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+func (s *Span) SetAttributes(attributes ...tracing.Attribute) {
+	s.span.SetAttributes(toKeyValues(attributes)...)
+}
+
+func (s *Span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func toKeyValues(attributes []tracing.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
+
+// Tracer implements the tracing.Tracer interface
+var _ tracing.Tracer = (*Tracer)(nil)
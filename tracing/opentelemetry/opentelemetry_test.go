@@ -0,0 +1,52 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracerRecordsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := tracer.Start(context.Background(), tracing.SpanVerifyAccessToken,
+		tracing.String(tracing.AttributeIssuer, "https://example.com"))
+	_, child := tracer.Start(ctx, tracing.SpanFetch)
+	child.SetAttributes(tracing.Int(tracing.AttributeStatusCode, 503))
+	child.End(errors.New("unavailable"))
+	parent.End(nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	fetch, verify := spans[0], spans[1]
+	require.Equal(t, tracing.SpanFetch, fetch.Name())
+	require.Equal(t, verify.SpanContext().SpanID(), fetch.Parent().SpanID())
+	require.Equal(t, codes.Error, fetch.Status().Code)
+	require.Contains(t, fetch.Attributes(), attribute.Int(tracing.AttributeStatusCode, 503))
+	require.Contains(t, verify.Attributes(), attribute.String(tracing.AttributeIssuer, "https://example.com"))
+	require.Equal(t, codes.Unset, verify.Status().Code)
+}
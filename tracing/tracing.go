@@ -0,0 +1,87 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package tracing
+
+import "context"
+
+// Span names started by the verifier and its adaptors
+const (
+	SpanVerifyAccessToken = "okta_jwt_verifier.verify_access_token"
+	SpanVerifyIdToken     = "okta_jwt_verifier.verify_id_token"
+	SpanVerifyLogoutToken = "okta_jwt_verifier.verify_logout_token"
+	SpanGetMetadata       = "okta_jwt_verifier.get_metadata"
+	SpanGetKeySet         = "okta_jwt_verifier.get_key_set"
+	SpanVerifySignature   = "okta_jwt_verifier.verify_signature"
+	SpanFetch             = "okta_jwt_verifier.fetch"
+)
+
+// Attribute keys set on the spans
+const (
+	AttributeIssuer      = "okta_jwt_verifier.issuer"
+	AttributeTokenType   = "okta_jwt_verifier.token_type"
+	AttributeKeyId       = "okta_jwt_verifier.kid"
+	AttributeAlgorithm   = "okta_jwt_verifier.alg"
+	AttributeOutcome     = "okta_jwt_verifier.outcome"
+	AttributeResource    = "okta_jwt_verifier.resource"
+	AttributeCacheResult = "okta_jwt_verifier.cache_result"
+	AttributeUrl         = "http.url"
+	AttributeStatusCode  = "http.status_code"
+)
+
+// Tracer starts spans. It is implemented by tracing/opentelemetry for
+// OpenTelemetry and can be implemented for any other tracing library.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if any, and returns
+	// a context carrying the new span.
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	// End finishes the span, marking it as failed when err is not nil.
+	End(err error)
+}
+
+// Attribute is a key and a string or int value describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Nop is a Tracer whose spans record nothing.
+type Nop struct{}
+
+func (Nop) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) End(error)                  {}
+
+// Nop implements the Tracer interface
+var _ Tracer = Nop{}
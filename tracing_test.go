@@ -0,0 +1,139 @@
+/*******************************************************************************
+ * Copyright 2018 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ ******************************************************************************/
+
+package jwtverifier
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/okta/okta-jwt-verifier-golang/v2/internal/testissuer"
+	"github.com/okta/okta-jwt-verifier-golang/v2/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+// recordedSpan is a span kept by recordingTracer
+type recordedSpan struct {
+	name       string
+	parent     *recordedSpan
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttributes(attributes ...tracing.Attribute) {
+	for _, a := range attributes {
+		s.attributes[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+type spanKey struct{}
+
+// recordingTracer keeps every span it starts
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attributes ...tracing.Attribute) (context.Context, tracing.Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attributes: map[string]interface{}{}}
+	span.SetAttributes(attributes...)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (t *recordingTracer) named(name string) []*recordedSpan {
+	var spans []*recordedSpan
+	for _, span := range t.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestTracerWrapsVerification(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	tracer := &recordingTracer{}
+	jvs := JwtVerifier{Issuer: testIssuer, Tracer: tracer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	caller := &recordedSpan{name: "request", attributes: map[string]interface{}{}}
+	ctx := context.WithValue(context.Background(), spanKey{}, caller)
+	_, err = jv.VerifyAccessTokenContext(ctx, key.Sign(t, validClaims()))
+	require.NoError(t, err)
+
+	verify := tracer.named(tracing.SpanVerifyAccessToken)
+	require.Len(t, verify, 1)
+	require.Same(t, caller, verify[0].parent)
+	require.True(t, verify[0].ended)
+	require.Equal(t, testIssuer, verify[0].attributes[tracing.AttributeIssuer])
+	require.Equal(t, "kid-1", verify[0].attributes[tracing.AttributeKeyId])
+	require.Equal(t, "RS256", verify[0].attributes[tracing.AttributeAlgorithm])
+	require.Equal(t, "valid", verify[0].attributes[tracing.AttributeOutcome])
+
+	for _, name := range []string{tracing.SpanGetMetadata, tracing.SpanGetKeySet, tracing.SpanVerifySignature} {
+		spans := tracer.named(name)
+		require.Len(t, spans, 1, name)
+		require.Same(t, verify[0], spans[0].parent, name)
+		require.True(t, spans[0].ended, name)
+	}
+	require.Equal(t, "miss", tracer.named(tracing.SpanGetMetadata)[0].attributes[tracing.AttributeCacheResult])
+
+	fetches := tracer.named(tracing.SpanFetch)
+	require.Len(t, fetches, 2)
+	for _, fetch := range fetches {
+		require.Nil(t, fetch.parent)
+		require.Equal(t, 200, fetch.attributes[tracing.AttributeStatusCode])
+	}
+}
+
+func TestTracerRecordsFailureOutcome(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	key := testissuer.NewKey(t, "kid-1")
+	testissuer.Register(t, key)
+
+	tracer := &recordingTracer{}
+	jvs := JwtVerifier{Issuer: testIssuer, Tracer: tracer}
+	jv, err := jvs.New()
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["iss"] = "https://other.example.com"
+	_, err = jv.VerifyIdToken(key.Sign(t, claims))
+	require.Error(t, err)
+
+	verify := tracer.named(tracing.SpanVerifyIdToken)
+	require.Len(t, verify, 1)
+	require.Equal(t, "invalid_issuer", verify[0].attributes[tracing.AttributeOutcome])
+	require.Equal(t, err, verify[0].err)
+}
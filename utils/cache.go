@@ -1,12 +1,19 @@
 package utils
 
 import (
+	"context"
+	stderrors "errors"
 	"sync"
 	"time"
 
+	"github.com/okta/okta-jwt-verifier-golang/v2/errors"
 	"github.com/patrickmn/go-cache"
 )
 
+// CacheFactory builds a Cacher around a lookup function, given the time
+// values are kept and the interval expired values are purged.
+type CacheFactory = func(lookup func(string) (interface{}, error), timeout, cleanup time.Duration) (Cacher, error)
+
 // Cacher is a read-only cache interface.
 //
 // Get returns the value associated with the given key.
@@ -14,40 +21,232 @@ type Cacher interface {
 	Get(string) (interface{}, error)
 }
 
+// ContextCacher is implemented by caches that let the caller stop waiting on
+// a lookup once its context is done.
+type ContextCacher interface {
+	Cacher
+	GetContext(context.Context, string) (interface{}, error)
+}
+
+// ManagedCacher is implemented by caches whose entries can be managed
+// directly.
+//
+// Invalidate drops the entry for key so that the next Get looks it up again,
+// Purge drops every entry, Set stores a value for ttl (zero meaning the
+// cache's default timeout) and Peek returns an entry without looking it up.
+type ManagedCacher interface {
+	Cacher
+	Invalidate(key string)
+	Purge()
+	Set(key string, value interface{}, ttl time.Duration)
+	Peek(key string) (Entry, bool)
+}
+
+// Entry describes a cached value. Err is set instead of Value when a lookup
+// error is cached.
+type Entry struct {
+	Value     interface{}
+	Err       error
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Age returns how long ago the entry was stored.
+func (e Entry) Age() time.Duration {
+	return time.Since(e.StoredAt)
+}
+
+// GetContext returns the value for the given key, using GetContext when the
+// cache implements ContextCacher. Plain Cachers are only checked for a done
+// context before the lookup starts.
+func GetContext(ctx context.Context, c Cacher, key string) (interface{}, error) {
+	if cc, ok := c.(ContextCacher); ok {
+		return cc.GetContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
 type defaultCache struct {
 	cache  *cache.Cache
 	lookup func(string) (interface{}, error)
-	mutex  *sync.Mutex
+	// mutex guards calls, the lookups in flight per key
+	mutex *sync.Mutex
+	calls map[string]*call
+	// errorTimeout is how long lookup errors are cached, zero disables it
+	errorTimeout time.Duration
+}
+
+// entry is what defaultCache stores for a key
+type entry struct {
+	value    interface{}
+	err      *errors.CachedLookup
+	storedAt time.Time
+}
+
+// call is a lookup in flight, shared by every caller that misses the same key
+type call struct {
+	done  chan struct{}
+	value interface{}
+	err   error
 }
 
 func (c *defaultCache) Get(key string) (interface{}, error) {
-	if value, found := c.cache.Get(key); found {
-		return value, nil
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext behaves like Get but returns ctx.Err() if the context is done
+// before the value is available. The lookup itself keeps running so its
+// result is still cached for the callers that come after.
+func (c *defaultCache) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if e, found := c.cache.Get(key); found {
+		return e.(entry).result()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+
+	call := c.join(key)
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// join returns the lookup in flight for key, starting one if there is none.
+// Concurrent misses on the same key share a single lookup while misses on
+// different keys proceed in parallel.
+func (c *defaultCache) join(key string) *call {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	// once lock, check the cache again because there could be
-	// another thread that has update the keys during the last check
-	if value, found := c.cache.Get(key); found {
-		return value, nil
+	// check the cache again because a lookup for the key could have
+	// completed since the last check
+	if e, found := c.cache.Get(key); found {
+		done := make(chan struct{})
+		close(done)
+		value, err := e.(entry).result()
+		return &call{done: done, value: value, err: err}
+	}
+	if inFlight, ok := c.calls[key]; ok {
+		return inFlight
 	}
 
-	value, err := c.lookup(key)
-	if err != nil {
-		return nil, err
+	inFlight := &call{done: make(chan struct{})}
+	c.calls[key] = inFlight
+	go func() {
+		inFlight.value, inFlight.err = c.lookup(key)
+		c.mutex.Lock()
+		// the key may have been invalidated while the lookup was in flight,
+		// its result is then handed to the waiting callers but not stored
+		if c.calls[key] == inFlight {
+			delete(c.calls, key)
+			c.store(key, inFlight.value, inFlight.err)
+		}
+		inFlight.value = UnwrapValue(inFlight.value)
+		c.mutex.Unlock()
+		close(inFlight.done)
+	}()
+	return inFlight
+}
+
+func (c *defaultCache) store(key string, value interface{}, err error) {
+	now := time.Now()
+	if err == nil {
+		if ev, ok := value.(ExpiringValue); ok && ev.TTL > 0 {
+			c.cache.Set(key, entry{value: ev.Value, storedAt: now}, ev.TTL)
+			return
+		}
+		c.cache.SetDefault(key, entry{value: UnwrapValue(value), storedAt: now})
+		return
+	}
+	if c.cacheable(err) {
+		cached := errors.CachedLookupError(key, err, now.Add(c.errorTimeout))
+		c.cache.Set(key, entry{err: cached, storedAt: now}, c.errorTimeout)
+	}
+}
+
+// cacheable reports whether a lookup error should be cached. Cancellations
+// say nothing about the resource and are never cached.
+func (c *defaultCache) cacheable(err error) bool {
+	return c.errorTimeout > 0 &&
+		!stderrors.Is(err, context.Canceled) &&
+		!stderrors.Is(err, context.DeadlineExceeded)
+}
+
+func (e entry) result() (interface{}, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.value, nil
+}
+
+func (c *defaultCache) Invalidate(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache.Delete(key)
+	delete(c.calls, key)
+}
+
+func (c *defaultCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache.Flush()
+	c.calls = map[string]*call{}
+}
+
+func (c *defaultCache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = cache.DefaultExpiration
 	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache.Set(key, entry{value: value, storedAt: time.Now()}, ttl)
+	delete(c.calls, key)
+}
 
-	c.cache.SetDefault(key, value)
-	return value, nil
+func (c *defaultCache) Peek(key string) (Entry, bool) {
+	e, expiresAt, found := c.cache.GetWithExpiration(key)
+	if !found {
+		return Entry{}, false
+	}
+	stored := e.(entry)
+	result := Entry{Value: stored.value, StoredAt: stored.storedAt, ExpiresAt: expiresAt}
+	if stored.err != nil {
+		result.Err = stored.err
+	}
+	return result, true
 }
 
-// defaultCache implements the Cacher interface
-var _ Cacher = (*defaultCache)(nil)
+// defaultCache implements the ContextCacher and ManagedCacher interfaces
+var (
+	_ ContextCacher = (*defaultCache)(nil)
+	_ ManagedCacher = (*defaultCache)(nil)
+)
 
 func NewDefaultCache(lookup func(string) (interface{}, error), timeout, cleanup time.Duration) (Cacher, error) {
+	return newDefaultCache(lookup, timeout, cleanup, 0), nil
+}
+
+// NewDefaultCacheWithErrorTimeout returns a CacheFactory for the default
+// cache that also caches lookup errors for errorTimeout. While an error is
+// cached Get returns an *errors.CachedLookup wrapping it instead of repeating
+// the lookup.
+func NewDefaultCacheWithErrorTimeout(errorTimeout time.Duration) CacheFactory {
+	return func(lookup func(string) (interface{}, error), timeout, cleanup time.Duration) (Cacher, error) {
+		return newDefaultCache(lookup, timeout, cleanup, errorTimeout), nil
+	}
+}
+
+func newDefaultCache(lookup func(string) (interface{}, error), timeout, cleanup, errorTimeout time.Duration) *defaultCache {
 	return &defaultCache{
-		cache:  cache.New(timeout, cleanup),
-		lookup: lookup,
-		mutex:  &sync.Mutex{},
-	}, nil
+		cache:        cache.New(timeout, cleanup),
+		lookup:       lookup,
+		mutex:        &sync.Mutex{},
+		calls:        map[string]*call{},
+		errorTimeout: errorTimeout,
+	}
 }
@@ -1,9 +1,15 @@
 package utils_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	jwterrors "github.com/okta/okta-jwt-verifier-golang/v2/errors"
 	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
 )
 
@@ -48,3 +54,269 @@ func TestNewDefaultCache(t *testing.T) {
 		t.Error("Expected cached value to be the same")
 	}
 }
+
+func TestDefaultCacheGetContext(t *testing.T) {
+	release := make(chan struct{})
+	lookup := func(key string) (interface{}, error) {
+		<-release
+		return &Value{key: key}, nil
+	}
+	cache, err := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := utils.GetContext(ctx, cache, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+
+	// the abandoned lookup still populates the cache
+	close(release)
+	value, err := utils.GetContext(context.Background(), cache, "slow")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value.(*Value).key != "slow" {
+		t.Errorf("Expected the looked up value, got %v", value)
+	}
+}
+
+func TestDefaultCacheCoalescesConcurrentMisses(t *testing.T) {
+	var lookups int32
+	release := make(chan struct{})
+	lookup := func(key string) (interface{}, error) {
+		atomic.AddInt32(&lookups, 1)
+		<-release
+		return &Value{key: key}, nil
+	}
+	cache, _ := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+
+	var wg sync.WaitGroup
+	values := make([]interface{}, 10)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _ = cache.Get("shared")
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Errorf("Expected a single lookup, got %d", n)
+	}
+	for _, v := range values {
+		if v != values[0] {
+			t.Error("Expected every caller to get the same value")
+		}
+	}
+}
+
+func TestDefaultCacheMissesOnDifferentKeysDoNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	lookup := func(key string) (interface{}, error) {
+		if key == "slow" {
+			<-release
+		}
+		return &Value{key: key}, nil
+	}
+	cache, _ := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+
+	go func() { _, _ = cache.Get("slow") }()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := utils.GetContext(ctx, cache, "fast"); err != nil {
+		t.Fatalf("Expected fast to be looked up while slow is in flight, got %v", err)
+	}
+}
+
+func TestDefaultCacheDoesNotCacheErrors(t *testing.T) {
+	calls := 0
+	lookup := func(key string) (interface{}, error) {
+		calls++
+		return nil, fmt.Errorf("lookup %d failed", calls)
+	}
+	cache, _ := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+
+	_, _ = cache.Get("key")
+	_, err := cache.Get("key")
+	if err == nil || err.Error() != "lookup 2 failed" {
+		t.Errorf("Expected the second lookup to run, got %v", err)
+	}
+}
+
+func TestDefaultCacheWithErrorTimeout(t *testing.T) {
+	calls := 0
+	lookup := func(key string) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("not found")
+		}
+		return &Value{key: key}, nil
+	}
+	cache, _ := utils.NewDefaultCacheWithErrorTimeout(20*time.Millisecond)(lookup, 5*time.Minute, 10*time.Minute)
+
+	if _, err := cache.Get("key"); err == nil || err.Error() != "not found" {
+		t.Fatalf("Expected the lookup error, got %v", err)
+	}
+
+	_, err := cache.Get("key")
+	var cached *jwterrors.CachedLookup
+	if !errors.As(err, &cached) {
+		t.Fatalf("Expected a cached lookup error, got %v", err)
+	}
+	if cached.Key != "key" || cached.Unwrap().Error() != "not found" {
+		t.Errorf("Expected the cached error to wrap the lookup error, got %v", cached)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the failing lookup not to be repeated, got %d calls", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := cache.Get("key"); err != nil {
+		t.Fatalf("Expected the lookup to be retried after the error timeout, got %v", err)
+	}
+}
+
+func TestDefaultCacheManagement(t *testing.T) {
+	calls := 0
+	lookup := func(key string) (interface{}, error) {
+		calls++
+		return fmt.Sprintf("%s-%d", key, calls), nil
+	}
+	c, _ := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+	cache, ok := c.(utils.ManagedCacher)
+	if !ok {
+		t.Fatal("Expected the default cache to be a ManagedCacher")
+	}
+
+	if _, found := cache.Peek("key"); found {
+		t.Error("Expected Peek not to look up missing keys")
+	}
+
+	first, _ := cache.Get("key")
+	entry, found := cache.Peek("key")
+	if !found || entry.Value != first || entry.Age() < 0 || !entry.ExpiresAt.After(time.Now()) {
+		t.Errorf("Expected Peek to describe the cached value, got %+v", entry)
+	}
+
+	cache.Invalidate("key")
+	second, _ := cache.Get("key")
+	if second != "key-2" {
+		t.Errorf("Expected Invalidate to force a lookup, got %v", second)
+	}
+
+	cache.Set("seeded", "value", time.Minute)
+	seeded, _ := cache.Get("seeded")
+	if seeded != "value" || calls != 2 {
+		t.Errorf("Expected the seeded value without a lookup, got %v after %d calls", seeded, calls)
+	}
+	entry, _ = cache.Peek("seeded")
+	if until := time.Until(entry.ExpiresAt); until > time.Minute || until < 50*time.Second {
+		t.Errorf("Expected the seeded value to expire in a minute, got %v", until)
+	}
+
+	cache.Purge()
+	if _, found := cache.Peek("key"); found {
+		t.Error("Expected Purge to drop every entry")
+	}
+	if _, found := cache.Peek("seeded"); found {
+		t.Error("Expected Purge to drop every entry")
+	}
+}
+
+func TestDefaultCacheInvalidateDuringLookup(t *testing.T) {
+	release := make(chan struct{})
+	calls := int32(0)
+	lookup := func(key string) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			return "stale", nil
+		}
+		return "fresh", nil
+	}
+	c, _ := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+	cache := c.(utils.ManagedCacher)
+
+	done := make(chan interface{})
+	go func() {
+		value, _ := cache.Get("key")
+		done <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cache.Invalidate("key")
+	close(release)
+	if value := <-done; value != "stale" {
+		t.Errorf("Expected the waiting caller to get the in flight result, got %v", value)
+	}
+
+	if value, _ := cache.Get("key"); value != "fresh" {
+		t.Errorf("Expected the invalidated lookup not to be cached, got %v", value)
+	}
+}
+
+// globalMutexCache serializes every miss behind one mutex, it is the
+// baseline BenchmarkCacheManyTenants compares the default cache against
+type globalMutexCache struct {
+	mutex  sync.Mutex
+	values sync.Map
+	lookup func(string) (interface{}, error)
+}
+
+func (c *globalMutexCache) Get(key string) (interface{}, error) {
+	if value, ok := c.values.Load(key); ok {
+		return value, nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if value, ok := c.values.Load(key); ok {
+		return value, nil
+	}
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	c.values.Store(key, value)
+	return value, nil
+}
+
+// BenchmarkCacheManyTenants looks up keys for many tenants whose first
+// lookup is slow, as a JWKS fetch would be.
+func BenchmarkCacheManyTenants(b *testing.B) {
+	lookup := func(key string) (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return &Value{key: key}, nil
+	}
+	caches := map[string]func() utils.Cacher{
+		"per-key": func() utils.Cacher {
+			cache, _ := utils.NewDefaultCache(lookup, 5*time.Minute, 10*time.Minute)
+			return cache
+		},
+		"global-mutex": func() utils.Cacher {
+			return &globalMutexCache{lookup: lookup}
+		},
+	}
+
+	for name, newCache := range caches {
+		b.Run(name, func(b *testing.B) {
+			cache := newCache()
+			var tenant int64
+			b.SetParallelism(16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := fmt.Sprintf("tenant-%d", atomic.AddInt64(&tenant, 1)%1000)
+					if _, err := cache.Get(key); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Codec converts the values of one cache to and from bytes, so that they can
+// be stored outside of the process.
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// CodecCacher is implemented by caches that store values outside of the
+// process. The owner of the cache sets the Codec for its values before the
+// first Get; until then values are stored as JSON and read back as
+// json.RawMessage.
+type CodecCacher interface {
+	Cacher
+	SetCodec(Codec)
+}
+
+// SetCodec sets the codec of c when it implements CodecCacher.
+func SetCodec(c Cacher, codec Codec) {
+	if cc, ok := c.(CodecCacher); ok {
+		cc.SetCodec(codec)
+	}
+}
+
+// rawJSONCodec is the Codec of caches whose owner did not set one
+type rawJSONCodec struct{}
+
+func (rawJSONCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (rawJSONCodec) Decode(data []byte) (interface{}, error) {
+	return json.RawMessage(data), nil
+}
+
+// storedEntry is how a value is serialized by the caches that keep values
+// outside of the process
+type storedEntry struct {
+	Key       string          `json:"key"`
+	StoredAt  time.Time       `json:"storedAt"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+	Value     json.RawMessage `json:"value"`
+}
+
+func encodeEntry(codec Codec, key string, value interface{}, ttl time.Duration) ([]byte, error) {
+	raw, err := codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return json.Marshal(storedEntry{Key: key, StoredAt: now, ExpiresAt: now.Add(ttl), Value: raw})
+}
+
+// decodeEntry returns the entry stored for key in data, it fails when data is
+// corrupted, belongs to another key or has expired.
+func decodeEntry(codec Codec, key string, data []byte) (Entry, error) {
+	stored := storedEntry{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Entry{}, fmt.Errorf("could not decode cache entry: %w", err)
+	}
+	if stored.Key != key || len(stored.Value) == 0 {
+		return Entry{}, fmt.Errorf("cache entry is not for %q", key)
+	}
+	if !time.Now().Before(stored.ExpiresAt) {
+		return Entry{}, fmt.Errorf("cache entry for %q has expired", key)
+	}
+	value, err := codec.Decode(stored.Value)
+	if err != nil {
+		return Entry{}, fmt.Errorf("could not decode cached value: %w", err)
+	}
+	return Entry{Value: value, StoredAt: stored.StoredAt, ExpiresAt: stored.ExpiresAt}, nil
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExpiringValue is returned by lookups that know how long their value stays
+// fresh. The default cache stores Value for TTL instead of its default
+// timeout; other caches store the ExpiringValue itself, so readers unwrap it
+// with UnwrapValue.
+type ExpiringValue struct {
+	Value interface{}
+	TTL   time.Duration
+}
+
+// UnwrapValue returns the value held by an ExpiringValue, or value itself.
+func UnwrapValue(value interface{}) interface{} {
+	if ev, ok := value.(ExpiringValue); ok {
+		return ev.Value
+	}
+	return value
+}
+
+// Fetcher downloads documents from the issuer. It revalidates documents it
+// has fetched before with `If-None-Match` and `If-Modified-Since`, and derives
+// how long they stay fresh from `Cache-Control: max-age` and `Expires`,
+// clamped between MinTTL and MaxTTL.
+type Fetcher struct {
+	Client HTTPClient
+	Retry  *RetryPolicy
+	MinTTL time.Duration
+	MaxTTL time.Duration
+	// Timeout bounds each Fetch, retries included. A fetch is shared by every
+	// caller waiting on its document, so it cannot rely on their contexts to
+	// end. Zero leaves it bounded by ctx alone.
+	Timeout time.Duration
+	// OnFetch, when set, is called after every Fetch with the status code the
+	// issuer answered with, zero if it did not answer.
+	OnFetch func(url string, statusCode int, d time.Duration, err error)
+
+	mutex      sync.Mutex
+	validators map[string]validator
+}
+
+// validator is what is needed to revalidate a previously fetched document
+type validator struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// FetchResult is a document returned by the issuer. NotModified is set when
+// the issuer confirmed that the previously fetched Body is still current. TTL
+// is zero when the issuer gave no freshness information, and positive when it
+// did, however short, as when it forbids caching.
+type FetchResult struct {
+	StatusCode  int
+	Body        []byte
+	TTL         time.Duration
+	NotModified bool
+}
+
+// Fetch requests url, retrying according to Retry. Responses other than 2xx
+// and 304 are returned with their status code and body for the caller to
+// report.
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*FetchResult, error) {
+	if f.OnFetch == nil {
+		return f.fetch(ctx, url)
+	}
+	start := time.Now()
+	result, err := f.fetch(ctx, url)
+	statusCode := 0
+	if result != nil {
+		statusCode = result.StatusCode
+		if result.NotModified {
+			statusCode = http.StatusNotModified
+		}
+	}
+	f.OnFetch(url, statusCode, time.Since(start), err)
+	return result, err
+}
+
+func (f *Fetcher) fetch(ctx context.Context, url string) (*FetchResult, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	previous, revalidate := f.validators[url]
+	f.mutex.Unlock()
+	if revalidate {
+		if previous.etag != "" {
+			req.Header.Set("If-None-Match", previous.etag)
+		}
+		if previous.lastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.lastModified)
+		}
+	}
+
+	retry := f.Retry
+	if retry == nil {
+		retry = &RetryPolicy{}
+	}
+	resp, err := retry.Do(ctx, f.Client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &FetchResult{StatusCode: resp.StatusCode}
+	if resp.StatusCode == http.StatusNotModified && revalidate {
+		result.StatusCode = http.StatusOK
+		result.Body = previous.body
+		result.NotModified = true
+		result.TTL = f.ttl(resp.Header)
+		return result, nil
+	}
+
+	result.Body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response from %q: %w", url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, nil
+	}
+	result.TTL = f.ttl(resp.Header)
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.validators == nil {
+		f.validators = map[string]validator{}
+	}
+	if etag != "" || lastModified != "" {
+		f.validators[url] = validator{etag: etag, lastModified: lastModified, body: result.Body}
+	} else {
+		delete(f.validators, url)
+	}
+	return result, nil
+}
+
+// noCacheTTL is the TTL of responses that must not be cached, such as those
+// with `no-store`, `no-cache` or `max-age=0`, when MinTTL is zero. A zero TTL
+// would mean the headers do not say, and the document be cached for the
+// cache's default timeout.
+const noCacheTTL = time.Nanosecond
+
+// ttl returns how long a response stays fresh according to its headers,
+// clamped between MinTTL and MaxTTL, or zero when the headers do not say.
+func (f *Fetcher) ttl(header http.Header) time.Duration {
+	ttl, ok := freshness(header)
+	if !ok {
+		return 0
+	}
+	if f.MaxTTL > 0 && ttl > f.MaxTTL {
+		ttl = f.MaxTTL
+	}
+	if ttl < f.MinTTL {
+		ttl = f.MinTTL
+	}
+	if ttl <= 0 {
+		ttl = noCacheTTL
+	}
+	return ttl
+}
+
+// freshness computes the freshness lifetime of a response as described in
+// RFC 9111 section 4.2.1, less its `Age`.
+func freshness(header http.Header) (time.Duration, bool) {
+	var ttl time.Duration
+	found := false
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				ttl, found = time.Duration(seconds)*time.Second, true
+			}
+		}
+	}
+
+	if !found {
+		expires := header.Get("Expires")
+		if expires == "" {
+			return 0, false
+		}
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			// an invalid Expires means already expired
+			return 0, true
+		}
+		now := time.Now()
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		ttl = expiresAt.Sub(now)
+	}
+
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+		ttl -= time.Duration(age) * time.Second
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return ttl, true
+}
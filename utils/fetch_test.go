@@ -0,0 +1,130 @@
+package utils_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+)
+
+func TestFetcherFreshness(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name   string
+		header http.Header
+		ttl    time.Duration
+	}{
+		{"no caching headers", http.Header{}, 0},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=120"}}, 2 * time.Minute},
+		{"max-age less age", http.Header{"Cache-Control": {"max-age=120"}, "Age": {"60"}}, time.Minute},
+		{"max-age above the maximum", http.Header{"Cache-Control": {"max-age=86400"}}, time.Hour},
+		{"max-age below the minimum", http.Header{"Cache-Control": {"max-age=1"}}, 30 * time.Second},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache"}}, 30 * time.Second},
+		{"expires", http.Header{
+			"Date":    {now.Format(http.TimeFormat)},
+			"Expires": {now.Add(10 * time.Minute).Format(http.TimeFormat)},
+		}, 10 * time.Minute},
+		{"max-age wins over expires", http.Header{
+			"Cache-Control": {"max-age=300"},
+			"Expires":       {now.Add(10 * time.Minute).Format(http.TimeFormat)},
+		}, 5 * time.Minute},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.header {
+					w.Header()[k] = v
+				}
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			fetcher := &utils.Fetcher{Client: server.Client(), MinTTL: 30 * time.Second, MaxTTL: time.Hour}
+			result, err := fetcher.Fetch(context.Background(), server.URL)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if result.TTL != tc.ttl {
+				t.Errorf("Expected a TTL of %v, got %v", tc.ttl, result.TTL)
+			}
+		})
+	}
+}
+
+func TestFetcherDoesNotCacheWithoutMinTTL(t *testing.T) {
+	for _, cacheControl := range []string{"no-store", "no-cache", "max-age=0"} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", cacheControl)
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		fetcher := &utils.Fetcher{Client: server.Client()}
+		result, err := fetcher.Fetch(context.Background(), server.URL)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// zero would mean the headers do not say
+		if result.TTL <= 0 || result.TTL >= time.Second {
+			t.Errorf("Expected %s to have a TTL next to zero, got %v", cacheControl, result.TTL)
+		}
+	}
+}
+
+func TestFetcherRevalidates(t *testing.T) {
+	var ifNoneMatch, ifModifiedSince string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch, ifModifiedSince = r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since")
+		if ifNoneMatch == `"v1"` {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	fetcher := &utils.Fetcher{Client: server.Client()}
+	first, err := fetcher.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ifNoneMatch != "" || first.NotModified {
+		t.Errorf("Expected the first request to be unconditional")
+	}
+
+	second, err := fetcher.Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ifNoneMatch != `"v1"` || ifModifiedSince != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("Expected validators to be sent, got %q and %q", ifNoneMatch, ifModifiedSince)
+	}
+	if !second.NotModified || second.StatusCode != http.StatusOK || string(second.Body) != `{"keys":[]}` {
+		t.Errorf("Expected the previous body to be reused, got %+v", second)
+	}
+	if second.TTL != time.Minute {
+		t.Errorf("Expected the TTL of the 304 response, got %v", second.TTL)
+	}
+}
+
+func TestDefaultCacheStoresExpiringValues(t *testing.T) {
+	lookup := func(key string) (interface{}, error) {
+		return utils.ExpiringValue{Value: key, TTL: time.Minute}, nil
+	}
+	c, _ := utils.NewDefaultCache(lookup, time.Hour, time.Hour)
+
+	value, err := c.Get("key")
+	if err != nil || value != "key" {
+		t.Fatalf("Expected the unwrapped value, got %v, %v", value, err)
+	}
+	entry, _ := c.(utils.ManagedCacher).Peek("key")
+	if until := time.Until(entry.ExpiresAt); until > time.Minute || until < 50*time.Second {
+		t.Errorf("Expected the value to expire in a minute, got %v", until)
+	}
+}
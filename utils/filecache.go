@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fileCacheSuffix = ".cache.json"
+
+// fileCache keeps values in memory like the default cache and persists them
+// to a directory, so that a new process can serve them without fetching.
+type fileCache struct {
+	dir     string
+	timeout time.Duration
+	codec   Codec
+	source  func(string) (interface{}, error)
+	memory  *defaultCache
+
+	// mutex guards restoring values from files and refreshing, the keys
+	// being refreshed in the background
+	mutex      sync.Mutex
+	refreshing map[string]bool
+
+	// keysMutex guards keys, the keys whose files this cache has written or
+	// read. Purge only removes those, other caches may share the directory.
+	keysMutex sync.Mutex
+	keys      map[string]bool
+}
+
+// NewFileCache returns a CacheFactory for a cache that persists its values as
+// JSON files in dir. A value read back from dir is served at once while a
+// fresh value is looked up in the background. Expired, unreadable or
+// corrupted files are ignored and replaced.
+//
+// The files are trusted as the issuer's documents, so dir must be private:
+// the cache refuses a directory, and ignores files, that are symbolic links,
+// owned by another user or writable by group or others.
+func NewFileCache(dir string) CacheFactory {
+	return func(lookup func(string) (interface{}, error), timeout, cleanup time.Duration) (Cacher, error) {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("could not create cache directory %q: %w", dir, err)
+		}
+		if err := checkPrivate(dir); err != nil {
+			return nil, fmt.Errorf("refusing cache directory %q: %w", dir, err)
+		}
+		c := &fileCache{dir: dir, timeout: timeout, codec: rawJSONCodec{}, source: lookup, refreshing: map[string]bool{}, keys: map[string]bool{}}
+		c.memory = newDefaultCache(c.lookup, timeout, cleanup, 0)
+		return c, nil
+	}
+}
+
+func (c *fileCache) SetCodec(codec Codec) {
+	c.codec = codec
+}
+
+func (c *fileCache) Get(key string) (interface{}, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+func (c *fileCache) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if _, found := c.memory.Peek(key); !found {
+		if value, ok := c.restore(key); ok {
+			return value, nil
+		}
+	}
+	return c.memory.GetContext(ctx, key)
+}
+
+// restore serves key from its file when it is not in memory. Concurrent
+// callers read the file once and start a single background refresh.
+func (c *fileCache) restore(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if entry, found := c.memory.Peek(key); found {
+		return entry.Value, true
+	}
+	entry, ok := c.read(key)
+	if !ok {
+		return nil, false
+	}
+	c.memory.Set(key, entry.Value, time.Until(entry.ExpiresAt))
+	if !c.refreshing[key] {
+		c.refreshing[key] = true
+		go c.refresh(key)
+	}
+	return entry.Value, true
+}
+
+// lookup calls the source lookup and persists its value
+func (c *fileCache) lookup(key string) (interface{}, error) {
+	value, err := c.source(key)
+	if err != nil {
+		return nil, err
+	}
+	ttl := c.timeout
+	if ev, ok := value.(ExpiringValue); ok && ev.TTL > 0 {
+		ttl = ev.TTL
+	}
+	// persisting is best effort, the value is served from memory regardless
+	_ = c.write(key, UnwrapValue(value), ttl)
+	return ExpiringValue{Value: UnwrapValue(value), TTL: ttl}, nil
+}
+
+func (c *fileCache) refresh(key string) {
+	defer func() {
+		c.mutex.Lock()
+		delete(c.refreshing, key)
+		c.mutex.Unlock()
+	}()
+	value, err := c.lookup(key)
+	if err != nil {
+		return
+	}
+	ev := value.(ExpiringValue)
+	c.memory.Set(key, ev.Value, ev.TTL)
+}
+
+func (c *fileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+fileCacheSuffix)
+}
+
+func (c *fileCache) read(key string) (Entry, bool) {
+	if checkPrivate(c.path(key)) != nil {
+		return Entry{}, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	c.track(key)
+	entry, err := decodeEntry(c.codec, key, data)
+	if err != nil {
+		_ = os.Remove(c.path(key))
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// track records that the file of key belongs to this cache
+func (c *fileCache) track(key string) {
+	c.keysMutex.Lock()
+	defer c.keysMutex.Unlock()
+	c.keys[key] = true
+}
+
+// checkPrivate returns an error unless path can only be changed by the
+// current user
+func checkPrivate(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("it is a symbolic link")
+	}
+	return checkOwnership(info)
+}
+
+// write stores the value atomically, readers see either the previous file or
+// the complete new one
+func (c *fileCache) write(key string, value interface{}, ttl time.Duration) error {
+	data, err := encodeEntry(c.codec, key, value, ttl)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	c.track(key)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *fileCache) Invalidate(key string) {
+	c.memory.Invalidate(key)
+	_ = os.Remove(c.path(key))
+}
+
+func (c *fileCache) Purge() {
+	c.memory.Purge()
+	c.keysMutex.Lock()
+	defer c.keysMutex.Unlock()
+	for key := range c.keys {
+		_ = os.Remove(c.path(key))
+	}
+	c.keys = map[string]bool{}
+}
+
+func (c *fileCache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = c.timeout
+	}
+	c.memory.Set(key, value, ttl)
+	_ = c.write(key, value, ttl)
+}
+
+func (c *fileCache) Peek(key string) (Entry, bool) {
+	if entry, found := c.memory.Peek(key); found {
+		return entry, true
+	}
+	return c.read(key)
+}
+
+// fileCache implements the ContextCacher, ManagedCacher and CodecCacher
+// interfaces
+var (
+	_ ContextCacher = (*fileCache)(nil)
+	_ ManagedCacher = (*fileCache)(nil)
+	_ CodecCacher   = (*fileCache)(nil)
+)
@@ -0,0 +1,236 @@
+package utils_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+)
+
+func TestFileCacheSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	var calls int32
+	lookup := func(key string) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"key": key, "call": n}, nil
+	}
+
+	first, err := utils.NewFileCache(dir)(lookup, time.Minute, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := first.Get("https://example.com/keys"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// a new process serves the persisted value without waiting on a lookup
+	release := make(chan struct{})
+	slowLookup := func(key string) (interface{}, error) {
+		<-release
+		return lookup(key)
+	}
+	second, _ := utils.NewFileCache(dir)(slowLookup, time.Minute, time.Minute)
+	value, err := second.Get("https://example.com/keys")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	raw, ok := value.(json.RawMessage)
+	if !ok || string(raw) != `{"call":1,"key":"https://example.com/keys"}` {
+		t.Errorf("Expected the persisted value, got %v", value)
+	}
+
+	// and refreshes it in the background
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		value, _ = second.Get("https://example.com/keys")
+		if _, ok := value.(map[string]interface{}); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("Expected the value to be refreshed, got %v", value)
+}
+
+func TestFileCacheRefreshesOnceOnColdStart(t *testing.T) {
+	dir := t.TempDir()
+	lookup := func(key string) (interface{}, error) {
+		return map[string]interface{}{"key": key}, nil
+	}
+	first, _ := utils.NewFileCache(dir)(lookup, time.Minute, time.Minute)
+	if _, err := first.Get("https://example.com/keys"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var calls int32
+	release := make(chan struct{})
+	slowLookup := func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return lookup(key)
+	}
+	second, _ := utils.NewFileCache(dir)(slowLookup, time.Minute, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := second.Get("https://example.com/keys"); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected a single background refresh, got %d", n)
+	}
+
+	// wait for the refresh to write its file before the directory is removed
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		value, _ := second.Get("https://example.com/keys")
+		if _, ok := value.(map[string]interface{}); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("Expected the value to be refreshed")
+}
+
+func TestFileCacheIgnoresCorruptedAndExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	var calls int32
+	lookup := func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"key": key}, nil
+	}
+	factory := utils.NewFileCache(dir)
+
+	cache, _ := factory(lookup, time.Minute, time.Minute)
+	_, _ = cache.Get("corrupted")
+	_, _ = cache.Get("expired")
+	files, _ := filepath.Glob(filepath.Join(dir, "*.cache.json"))
+	if len(files) != 2 {
+		t.Fatalf("Expected two persisted files, got %v", files)
+	}
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		var p map[string]interface{}
+		_ = json.Unmarshal(data, &p)
+		if p["key"] == "corrupted" {
+			_ = os.WriteFile(f, data[:len(data)/2], 0o600)
+		} else {
+			p["expiresAt"] = time.Now().Add(-time.Second)
+			data, _ = json.Marshal(p)
+			_ = os.WriteFile(f, data, 0o600)
+		}
+	}
+
+	cache, _ = factory(lookup, time.Minute, time.Minute)
+	for _, key := range []string{"corrupted", "expired"} {
+		value, err := cache.Get(key)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			t.Errorf("Expected %s to be looked up again, got %v", key, value)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Errorf("Expected 4 lookups, got %d", n)
+	}
+}
+
+func TestFileCacheInvalidateRemovesFile(t *testing.T) {
+	dir := t.TempDir()
+	lookup := func(key string) (interface{}, error) {
+		return map[string]interface{}{"key": key}, nil
+	}
+	c, _ := utils.NewFileCache(dir)(lookup, time.Minute, time.Minute)
+	cache := c.(utils.ManagedCacher)
+
+	_, _ = cache.Get("key")
+	cache.Invalidate("key")
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.cache.json")); len(files) != 0 {
+		t.Errorf("Expected the persisted file to be removed, got %v", files)
+	}
+}
+
+func TestFileCacheRefusesSharedDirectories(t *testing.T) {
+	lookup := func(key string) (interface{}, error) {
+		return map[string]interface{}{"key": key}, nil
+	}
+
+	shared := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(shared, 0o700); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = os.Chmod(shared, 0o777)
+	if _, err := utils.NewFileCache(shared)(lookup, time.Minute, time.Minute); err == nil {
+		t.Errorf("Expected a world-writable directory to be refused")
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(t.TempDir(), link); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := utils.NewFileCache(link)(lookup, time.Minute, time.Minute); err == nil {
+		t.Errorf("Expected a symbolic link to be refused")
+	}
+}
+
+func TestFileCacheIgnoresFilesWritableByOthers(t *testing.T) {
+	dir := t.TempDir()
+	var calls int32
+	lookup := func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"key": key}, nil
+	}
+	factory := utils.NewFileCache(dir)
+	cache, _ := factory(lookup, time.Minute, time.Minute)
+	_, _ = cache.Get("key")
+	files, _ := filepath.Glob(filepath.Join(dir, "*.cache.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one persisted file, got %v", files)
+	}
+	_ = os.Chmod(files[0], 0o666)
+
+	cache, _ = factory(lookup, time.Minute, time.Minute)
+	value, err := cache.Get("key")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		t.Errorf("Expected the key to be looked up again, got %v", value)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 lookups, got %d", n)
+	}
+}
+
+func TestFileCachePurgeKeepsOtherCachesFiles(t *testing.T) {
+	dir := t.TempDir()
+	lookup := func(key string) (interface{}, error) {
+		return map[string]interface{}{"key": key}, nil
+	}
+	metadata, _ := utils.NewFileCache(dir)(lookup, time.Minute, time.Minute)
+	keys, _ := utils.NewFileCache(dir)(lookup, time.Minute, time.Minute)
+	_, _ = metadata.Get("https://example.com/.well-known/openid-configuration")
+	_, _ = keys.Get("https://example.com/keys")
+
+	keys.(utils.ManagedCacher).Purge()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.cache.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected only the metadata file to remain, got %v", files)
+	}
+	if _, found := metadata.(utils.ManagedCacher).Peek("https://example.com/.well-known/openid-configuration"); !found {
+		t.Errorf("Expected the metadata to remain cached")
+	}
+}
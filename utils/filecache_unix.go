@@ -0,0 +1,21 @@
+//go:build unix
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkOwnership returns an error when the file of info is owned by another
+// user or writable by group or others
+func checkOwnership(info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("it is owned by uid %d", stat.Uid)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("it is writable by group or others (%v)", info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+)
+
+// scriptedClient answers each request with the next status code, a zero
+// status code stands for a network error
+type scriptedClient struct {
+	statuses []int
+	header   http.Header
+	calls    int
+	bodies   []string
+}
+
+func (c *scriptedClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		c.bodies = append(c.bodies, string(body))
+	}
+	status := c.statuses[c.calls]
+	c.calls++
+	if status == 0 {
+		return nil, errors.New("connection reset by peer")
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     c.header,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func testPolicy() *utils.RetryPolicy {
+	policy := utils.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 10 * time.Millisecond
+	return policy
+}
+
+func TestRetryPolicyRetriesTransientFailures(t *testing.T) {
+	client := &scriptedClient{statuses: []int{0, 502, 200}}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	resp, err := testPolicy().Do(context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != 200 || client.calls != 3 {
+		t.Errorf("Expected 200 after 3 calls, got %d after %d calls", resp.StatusCode, client.calls)
+	}
+}
+
+func TestRetryPolicyReturnsNonRetryableResponse(t *testing.T) {
+	client := &scriptedClient{statuses: []int{404, 200}}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	resp, err := testPolicy().Do(context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != 404 || client.calls != 1 {
+		t.Errorf("Expected 404 after 1 call, got %d after %d calls", resp.StatusCode, client.calls)
+	}
+}
+
+func TestRetryPolicyStopsAfterMaxAttempts(t *testing.T) {
+	client := &scriptedClient{statuses: []int{503, 503, 503, 200}}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	resp, err := testPolicy().Do(context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != 503 || client.calls != 3 {
+		t.Errorf("Expected 503 after 3 calls, got %d after %d calls", resp.StatusCode, client.calls)
+	}
+}
+
+func TestRetryPolicyHonorsRetryAfter(t *testing.T) {
+	client := &scriptedClient{statuses: []int{429, 200}, header: http.Header{"Retry-After": []string{"1"}}}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	// a Retry-After longer than MaxBackoff is not waited for
+	resp, err := testPolicy().Do(context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != 429 || client.calls != 1 {
+		t.Errorf("Expected 429 after 1 call, got %d after %d calls", resp.StatusCode, client.calls)
+	}
+
+	client = &scriptedClient{statuses: []int{429, 200}, header: http.Header{"Retry-After": []string{"1"}}}
+	policy := testPolicy()
+	policy.MaxBackoff = 2 * time.Second
+	start := time.Now()
+	resp, err = policy.Do(context.Background(), client, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != 200 || time.Since(start) < time.Second {
+		t.Errorf("Expected 200 after waiting 1s, got %d after %v", resp.StatusCode, time.Since(start))
+	}
+}
+
+func TestRetryPolicyDoesNotExceedDeadline(t *testing.T) {
+	client := &scriptedClient{statuses: []int{503, 200}}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	policy := testPolicy()
+	policy.InitialBackoff = time.Second
+	policy.MaxBackoff = time.Second
+	policy.Jitter = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, err := policy.Do(ctx, client, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.StatusCode != 503 || client.calls != 1 {
+		t.Errorf("Expected 503 after 1 call, got %d after %d calls", resp.StatusCode, client.calls)
+	}
+}
+
+func TestRetryPolicyResendsRequestBody(t *testing.T) {
+	client := &scriptedClient{statuses: []int{503, 200}}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("token=abc"))
+
+	if _, err := testPolicy().Do(context.Background(), client, req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(client.bodies) != 2 || client.bodies[1] != "token=abc" {
+		t.Errorf("Expected the body to be sent with both attempts, got %q", client.bodies)
+	}
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Backend is a key/value store shared by several processes, such as Redis or
+// memcached. Get reports found as false for missing keys; errors are treated
+// as misses by the cache so that an unavailable backend never fails a
+// verification. Each call is bounded by the backend timeout of the cache, so
+// that an unreachable backend does not hold up the lookups waiting on it.
+type Backend interface {
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// tieredCache serves values from memory, then from a shared Backend, and only
+// then looks them up.
+type tieredCache struct {
+	backend        Backend
+	backendTimeout time.Duration
+	timeout        time.Duration
+	codec          Codec
+	source         func(string) (interface{}, error)
+	memory         *defaultCache
+}
+
+// DefaultBackendTimeout bounds each call to the Backend of NewTieredCache
+const DefaultBackendTimeout = time.Second
+
+// NewTieredCache returns a CacheFactory for a two-tier cache: the default
+// in-memory cache in front of backend. A value missing from memory is read
+// from backend, and a value missing from both is looked up and written to
+// backend for the other processes. Backend calls taking longer than
+// DefaultBackendTimeout are abandoned as misses.
+func NewTieredCache(backend Backend) CacheFactory {
+	return NewTieredCacheWithBackendTimeout(backend, DefaultBackendTimeout)
+}
+
+// NewTieredCacheWithBackendTimeout returns a CacheFactory for the cache of
+// NewTieredCache with each backend call bounded by backendTimeout instead.
+func NewTieredCacheWithBackendTimeout(backend Backend, backendTimeout time.Duration) CacheFactory {
+	return func(lookup func(string) (interface{}, error), timeout, cleanup time.Duration) (Cacher, error) {
+		c := &tieredCache{
+			backend:        backend,
+			backendTimeout: backendTimeout,
+			timeout:        timeout,
+			codec:          rawJSONCodec{},
+			source:         lookup,
+		}
+		c.memory = newDefaultCache(c.lookup, timeout, cleanup, 0)
+		return c, nil
+	}
+}
+
+func (c *tieredCache) SetCodec(codec Codec) {
+	c.codec = codec
+}
+
+func (c *tieredCache) Get(key string) (interface{}, error) {
+	return c.memory.Get(key)
+}
+
+func (c *tieredCache) GetContext(ctx context.Context, key string) (interface{}, error) {
+	return c.memory.GetContext(ctx, key)
+}
+
+// lookup reads key from the backend, falling back to the source lookup
+func (c *tieredCache) lookup(key string) (interface{}, error) {
+	if entry, ok := c.read(key); ok {
+		return ExpiringValue{Value: entry.Value, TTL: time.Until(entry.ExpiresAt)}, nil
+	}
+
+	value, err := c.source(key)
+	if err != nil {
+		return nil, err
+	}
+	ttl := c.timeout
+	if ev, ok := value.(ExpiringValue); ok && ev.TTL > 0 {
+		ttl = ev.TTL
+	}
+	// sharing is best effort, the value is served from memory regardless
+	_ = c.write(key, UnwrapValue(value), ttl)
+	return ExpiringValue{Value: UnwrapValue(value), TTL: ttl}, nil
+}
+
+// backendContext returns the context of a backend call
+func (c *tieredCache) backendContext() (context.Context, context.CancelFunc) {
+	if c.backendTimeout <= 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), c.backendTimeout)
+}
+
+func (c *tieredCache) read(key string) (Entry, bool) {
+	ctx, cancel := c.backendContext()
+	defer cancel()
+	data, found, err := c.backend.Get(ctx, key)
+	if err != nil || !found {
+		return Entry{}, false
+	}
+	entry, err := decodeEntry(c.codec, key, data)
+	if err != nil {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+func (c *tieredCache) write(key string, value interface{}, ttl time.Duration) error {
+	data, err := encodeEntry(c.codec, key, value, ttl)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := c.backendContext()
+	defer cancel()
+	return c.backend.Set(ctx, key, data, ttl)
+}
+
+// Invalidate drops key from memory and from the backend.
+func (c *tieredCache) Invalidate(key string) {
+	c.memory.Invalidate(key)
+	ctx, cancel := c.backendContext()
+	defer cancel()
+	_ = c.backend.Delete(ctx, key)
+}
+
+// Purge only drops the entries held in memory, the backend is shared and is
+// left untouched.
+func (c *tieredCache) Purge() {
+	c.memory.Purge()
+}
+
+func (c *tieredCache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = c.timeout
+	}
+	c.memory.Set(key, value, ttl)
+	_ = c.write(key, value, ttl)
+}
+
+func (c *tieredCache) Peek(key string) (Entry, bool) {
+	if entry, found := c.memory.Peek(key); found {
+		return entry, true
+	}
+	return c.read(key)
+}
+
+// tieredCache implements the ContextCacher, ManagedCacher and CodecCacher
+// interfaces
+var (
+	_ ContextCacher = (*tieredCache)(nil)
+	_ ManagedCacher = (*tieredCache)(nil)
+	_ CodecCacher   = (*tieredCache)(nil)
+)
+
+// MemoryBackend is an in-process Backend, meant for tests of code that uses a
+// shared cache.
+type MemoryBackend struct {
+	mutex   sync.Mutex
+	entries map[string]memoryBackendEntry
+}
+
+type memoryBackendEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: map[string]memoryBackendEntry{}}
+}
+
+func (b *MemoryBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	e, found := b.entries[key]
+	if !found || (!e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt)) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (b *MemoryBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	e := memoryBackendEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	b.entries[key] = e
+	return nil
+}
+
+func (b *MemoryBackend) Delete(_ context.Context, key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.entries, key)
+	return nil
+}
+
+// Len returns the number of entries held, expired or not.
+func (b *MemoryBackend) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.entries)
+}
+
+// MemoryBackend implements the Backend interface
+var _ Backend = (*MemoryBackend)(nil)
@@ -0,0 +1,132 @@
+package utils_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/okta/okta-jwt-verifier-golang/v2/utils"
+)
+
+func TestTieredCacheSharesValuesThroughBackend(t *testing.T) {
+	backend := utils.NewMemoryBackend()
+	var calls int32
+	lookup := func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"key": key}, nil
+	}
+
+	first, _ := utils.NewTieredCache(backend)(lookup, time.Minute, time.Minute)
+	second, _ := utils.NewTieredCache(backend)(lookup, time.Minute, time.Minute)
+
+	if _, err := first.Get("key"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if backend.Len() != 1 {
+		t.Fatalf("Expected the value to be written to the backend, got %d entries", backend.Len())
+	}
+	if _, err := second.Get("key"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected the second cache to read the backend instead of looking up, got %d lookups", n)
+	}
+
+	second.(utils.ManagedCacher).Invalidate("key")
+	if backend.Len() != 0 {
+		t.Errorf("Expected Invalidate to delete the backend entry")
+	}
+}
+
+// upperCodec decodes values as upper case strings to show that the owner's
+// codec is used
+type upperCodec struct{}
+
+func (upperCodec) Encode(value interface{}) ([]byte, error) {
+	return []byte(`"` + value.(string) + `"`), nil
+}
+
+func (upperCodec) Decode(data []byte) (interface{}, error) {
+	return "decoded " + string(data[1:len(data)-1]), nil
+}
+
+func TestTieredCacheUsesCodec(t *testing.T) {
+	backend := utils.NewMemoryBackend()
+	lookup := func(key string) (interface{}, error) {
+		return "value", nil
+	}
+
+	first, _ := utils.NewTieredCache(backend)(lookup, time.Minute, time.Minute)
+	utils.SetCodec(first, upperCodec{})
+	_, _ = first.Get("key")
+
+	second, _ := utils.NewTieredCache(backend)(lookup, time.Minute, time.Minute)
+	utils.SetCodec(second, upperCodec{})
+	value, _ := second.Get("key")
+	if value != "decoded value" {
+		t.Errorf("Expected the value to be decoded by the codec, got %v", value)
+	}
+}
+
+// failingBackend is an unavailable backend
+type failingBackend struct{}
+
+func (failingBackend) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingBackend) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingBackend) Delete(context.Context, string) error {
+	return errors.New("connection refused")
+}
+
+func TestTieredCacheToleratesBackendFailures(t *testing.T) {
+	lookup := func(key string) (interface{}, error) {
+		return "value", nil
+	}
+	cache, _ := utils.NewTieredCache(failingBackend{})(lookup, time.Minute, time.Minute)
+
+	value, err := cache.Get("key")
+	if err != nil || value != "value" {
+		t.Errorf("Expected the looked up value, got %v, %v", value, err)
+	}
+}
+
+// hangingBackend blocks every call until its context is done
+type hangingBackend struct{}
+
+func (hangingBackend) Get(ctx context.Context, _ string) ([]byte, bool, error) {
+	<-ctx.Done()
+	return nil, false, ctx.Err()
+}
+
+func (hangingBackend) Set(ctx context.Context, _ string, _ []byte, _ time.Duration) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (hangingBackend) Delete(ctx context.Context, _ string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestTieredCacheBoundsBackendCalls(t *testing.T) {
+	lookup := func(key string) (interface{}, error) {
+		return "value", nil
+	}
+	cache, _ := utils.NewTieredCacheWithBackendTimeout(hangingBackend{}, 20*time.Millisecond)(lookup, time.Minute, time.Minute)
+
+	start := time.Now()
+	value, err := cache.Get("key")
+	if err != nil || value != "value" {
+		t.Errorf("Expected the looked up value, got %v, %v", value, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the backend calls to be abandoned, the lookup took %v", elapsed)
+	}
+}